@@ -15,6 +15,7 @@
 package nulsio2
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,12 +23,29 @@ import (
 	"github.com/imroc/req"
 	"github.com/shopspring/decimal"
 	"github.com/tidwall/gjson"
+	"math/big"
+	"net/http"
 	"strconv"
+	"time"
 )
 
 type Client struct {
-	BaseURL string
-	Debug   bool
+	bestHeight     int64 //jsonrpc接口最近获取的最新高度，原子读写，放在首位保证64位对齐
+	bestHeightTime int64 //获取最新高度的时间，单位纳秒
+
+	BaseURL      string
+	Debug        bool
+	Backend      string        //接口类型，rest 或 jsonrpc，默认rest
+	ChainId      int64         //jsonrpc接口的链ID
+	HTTPClient   *http.Client  //发送请求的http客户端，包含超时时间
+	MaxRetries   int           //GET请求失败的重试次数
+	RetryWaitMin time.Duration //重试的最短等待时间
+	RetryWaitMax time.Duration //重试的最长等待时间
+
+	MaxHeightLag        int64         //节点落后最高节点超过该区块数时移出轮换
+	HealthCheckInterval time.Duration //节点健康检查的间隔
+	BroadcastAll        bool          //广播交易时发送到所有健康节点
+	pool                *endpointPool //多节点池，未设置时只使用BaseURL
 }
 
 type Response struct {
@@ -108,6 +126,13 @@ type Response struct {
 
 //获取最新高度
 func (this *Client) GetNewHeight() (int64, error) {
+	if this.isJSONRPC() {
+		nusBlock, err := this.rpcGetNewBlock()
+		if err != nil {
+			return 0, err
+		}
+		return nusBlock.Height, nil
+	}
 	result, err := this.CallReq("/api/block/newest")
 	if err != nil {
 		log.Errorf("get GetNewHeight faield, err = %v \n", err)
@@ -132,25 +157,12 @@ func (this *Client) GetNewHeight() (int64, error) {
 //获取最新高度
 func (this *Client) GetTokenBalances(contractAddress, address string) (decimal.Decimal, error) {
 	balance := decimal.Zero
-	target := "/api/contract/balance/token/" + contractAddress + "/" + address
-	result, err := this.CallReq(target)
+	tokenBalance, err := this.getTokenBalance(contractAddress, address)
 	if err != nil {
 		log.Errorf("get GetTokenBalances faield, err = %v \n", err)
 		return balance, err
 	}
 
-	if result.Type != gjson.JSON {
-		log.Errorf("result of GetTokenBalances type error")
-		return balance, errors.New("result of GetNewBlock type error")
-	}
-
-	var tokenBalance *TokenBalance
-	err = json.Unmarshal([]byte(result.Raw), &tokenBalance)
-	if err != nil {
-		log.Errorf("GetBalance decode json [%v] failed, err=%v", []byte(result.Raw), err)
-		return balance, err
-	}
-
 	if tokenBalance == nil {
 		return balance, errors.New("token balances is zero.")
 	}
@@ -173,25 +185,12 @@ func (this *Client) GetTokenBalances(contractAddress, address string) (decimal.D
 //获取最新高度
 func (this *Client) GetTokenBalancesReal(contractAddress, address string) (decimal.Decimal, error) {
 	balance := decimal.Zero
-	target := "/api/contract/balance/token/" + contractAddress + "/" + address
-	result, err := this.CallReq(target)
+	tokenBalance, err := this.getTokenBalance(contractAddress, address)
 	if err != nil {
 		log.Errorf("get GetTokenBalancesReal faield, err = %v \n", err)
 		return balance, err
 	}
 
-	if result.Type != gjson.JSON {
-		log.Errorf("result of GetTokenBalancesReal type error")
-		return balance, errors.New("result of GetNewBlock type error")
-	}
-
-	var tokenBalance *TokenBalance
-	err = json.Unmarshal([]byte(result.Raw), &tokenBalance)
-	if err != nil {
-		log.Errorf("GetBalance decode json [%v] failed, err=%v", []byte(result.Raw), err)
-		return balance, err
-	}
-
 	if tokenBalance == nil {
 		return balance, errors.New("token balances is zero.")
 	}
@@ -204,8 +203,37 @@ func (this *Client) GetTokenBalancesReal(contractAddress, address string) (decim
 	return balanceStr, nil
 }
 
+//getTokenBalance 查询地址的NRC20代币余额
+func (this *Client) getTokenBalance(contractAddress, address string) (*TokenBalance, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetTokenBalance(contractAddress, address)
+	}
+
+	target := "/api/contract/balance/token/" + contractAddress + "/" + address
+	result, err := this.CallReq(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Type != gjson.JSON {
+		return nil, errors.New("result of GetTokenBalances type error")
+	}
+
+	var tokenBalance *TokenBalance
+	err = json.Unmarshal([]byte(result.Raw), &tokenBalance)
+	if err != nil {
+		log.Errorf("GetBalance decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		return nil, err
+	}
+
+	return tokenBalance, nil
+}
+
 //获取最新高度区块信息
 func (this *Client) GetNewBlock() (*NusBlock, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetNewBlock()
+	}
 	result, err := this.CallReq("/api/block/newest")
 	if err != nil {
 		log.Errorf("get GetNewBlock faield, err = %v \n", err)
@@ -228,6 +256,9 @@ func (this *Client) GetNewBlock() (*NusBlock, error) {
 
 //通过高度获取区块
 func (this *Client) GetBlockByHeight(height int64) (*NusBlock, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetBlockByHeight(height)
+	}
 	result, err := this.CallReq("/api/block/height/" + strconv.FormatInt(height, 10))
 	if err != nil {
 		log.Errorf("GetBlockByHeight  faield, err = %v \n", err)
@@ -259,6 +290,9 @@ func (this *Client) GetBlockByHeight(height int64) (*NusBlock, error) {
 
 //通过hash获取区块
 func (this *Client) GetBlockByHash(hash string) (*NusBlock, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetBlockByHash(hash)
+	}
 	result, err := this.CallReq("/api/block/hash/" + hash)
 	if err != nil {
 		log.Errorf("GetBlockByHash  faield, err = %v \n", err)
@@ -289,6 +323,9 @@ func (this *Client) GetBlockByHash(hash string) (*NusBlock, error) {
 
 //通过tx获取交易
 func (this *Client) GetTxByTxId(txId string) (*Tx, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetTxByTxId(txId)
+	}
 	result, err := this.CallReq("/api/tx/" + txId)
 	if err != nil {
 		log.Errorf("GetBlockByHash  faield, err = %v \n", err)
@@ -310,49 +347,111 @@ func (this *Client) GetTxByTxId(txId string) (*Tx, error) {
 	return tx, nil
 }
 
+//GetUnconfirmedTxs 获取交易池中的未确认交易
+func (this *Client) GetUnconfirmedTxs() ([]*Tx, error) {
+	if this.isJSONRPC() {
+		return nil, errors.New("GetUnconfirmedTxs is not supported by jsonrpc backend")
+	}
+	result, err := this.CallReq("/api/tx/unconfirmed")
+	if err != nil {
+		log.Errorf("GetUnconfirmedTxs faield, err = %v \n", err)
+		return nil, err
+	}
+
+	//分页结果的交易在list中
+	list := *result
+	if result.Get("list").Exists() {
+		list = result.Get("list")
+	}
+
+	if !list.IsArray() {
+		log.Errorf("result of GetUnconfirmedTxs type error")
+		return nil, errors.New("result of GetUnconfirmedTxs type error")
+	}
+
+	var txs []*Tx
+	err = json.Unmarshal([]byte(list.Raw), &txs)
+	if err != nil {
+		log.Errorf("GetUnconfirmedTxs decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		return nil, err
+	}
+
+	return txs, nil
+}
+
 //通过tx获取合约
 func (this *Client) GetTokenByHash(hash string) ([]*NulsToken, error) {
-	result, err := this.CallReq("/api/contract/result/" + hash)
+	contractResult, err := this.GetContractResult(hash)
 	if err != nil {
-		log.Errorf("GetTokenByHash  faield, err = %v \n", err)
 		return nil, err
 	}
 
-	if result.Type != gjson.JSON {
-		log.Errorf("result of GetTokenByHash type error")
-		return nil, errors.New("result of GetTokenByHash type error")
+	if !contractResult.Success {
+		return nil, errors.New("the token does't success")
 	}
 
-	if !result.Get("data").Exists() {
-		return nil, errors.New("can't find the Token Trans")
+	return contractResult.TokenTransfers, nil
+}
+
+//GetContractTransfers 获取合约调用中合约内部转出的NULS
+func (this *Client) GetContractTransfers(hash string) ([]*ContractTransfer, error) {
+	contractResult, err := this.GetContractResult(hash)
+	if err != nil {
+		return nil, err
 	}
 
-	data := result.Get("data")
+	if !contractResult.Success {
+		return nil, errors.New("the contract call does't success")
+	}
 
-	if !data.Get("success").Bool() {
-		return nil, errors.New("the token does't success")
+	return contractResult.Transfers, nil
+}
+
+//GetContractResult 获取合约调用的执行结果，包括NRC20和NRC721转账
+func (this *Client) GetContractResult(hash string) (*ContractResult, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetContractResult(hash)
+	}
+	result, err := this.CallReq("/api/contract/result/" + hash)
+	if err != nil {
+		log.Errorf("GetContractResult  faield, err = %v \n", err)
+		return nil, err
 	}
 
-	tokenTransfers := data.Get("tokenTransfers").Raw
+	if result.Type != gjson.JSON {
+		log.Errorf("result of GetContractResult type error")
+		return nil, errors.New("result of GetContractResult type error")
+	}
+
+	if !result.Get("data").Exists() {
+		return nil, errors.New("can't find the Token Trans")
+	}
 
-	var nulsTokens []*NulsToken
-	err = json.Unmarshal([]byte(tokenTransfers), &nulsTokens)
+	var contractResult ContractResult
+	err = json.Unmarshal([]byte(result.Get("data").Raw), &contractResult)
 	if err != nil {
-		log.Errorf("GetTokenByHash decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		log.Errorf("GetContractResult decode json [%v] failed, err=%v", []byte(result.Raw), err)
 		return nil, err
 	}
 
-	if nulsTokens != nil && len(nulsTokens) > 0 {
-		for _, v := range nulsTokens {
-			v.Hash = hash
-		}
+	contractResult.Hash = hash
+	for _, v := range contractResult.TokenTransfers {
+		v.Hash = hash
+		v.Protocol = Nrc20Protocol
+	}
+	for _, v := range contractResult.Token721Transfers {
+		v.Hash = hash
+		v.Protocol = Nrc721Protocol
 	}
 
-	return nulsTokens, nil
+	return &contractResult, nil
 }
 
 //广播交易
 func (this *Client) VaildTransaction(hex string) (bool, error) {
+	if this.isJSONRPC() {
+		return this.rpcValidateTransaction(hex)
+	}
 
 	params := make(map[string]interface{})
 	params["txHex"] = hex
@@ -365,15 +464,26 @@ func (this *Client) VaildTransaction(hex string) (bool, error) {
 		return true, nil
 	}
 
-	return false, errors.New(result.Raw)
+	return false, parseNodeError(*result)
 }
 
 //广播交易
 func (this *Client) SendRawTransaction(hex string) (string, error) {
+	if this.isJSONRPC() {
+		return this.rpcSendRawTransaction(hex)
+	}
 
 	params := make(map[string]interface{})
 	params["txHex"] = hex
-	result, err := this.CallPost("/api/accountledger/transaction/broadcast", params)
+	var (
+		result *gjson.Result
+		err    error
+	)
+	if this.BroadcastAll {
+		result, err = this.CallPostAll("/api/accountledger/transaction/broadcast", params)
+	} else {
+		result, err = this.CallPost("/api/accountledger/transaction/broadcast", params)
+	}
 	if err != nil {
 		log.Errorf("SendRawTransaction  faield, err = %v \n", err)
 		return "", err
@@ -388,67 +498,155 @@ func (this *Client) SendRawTransaction(hex string) (string, error) {
 		return result.Get("hash").String(), nil
 	}
 
-	return "", errors.New(result.Raw)
+	return "", parseNodeError(*result)
 }
 
-func (c *Client) Call(method string, id int64, params []interface{}) (*gjson.Result, error) {
-	authHeader := req.Header{
-		"Accept":       "application/json",
-		"Content-Type": "application/json",
+//ImputedContractCallGas 预估合约调用消耗的gas
+func (this *Client) ImputedContractCallGas(sender string, value *big.Int, contractAddress, methodName, methodDesc string, args []interface{}) (uint64, error) {
+	if value == nil {
+		value = big.NewInt(0)
+	}
+	if this.isJSONRPC() {
+		return this.rpcImputedContractCallGas(sender, value, contractAddress, methodName, methodDesc, args)
+	}
+	params := make(map[string]interface{})
+	params["sender"] = sender
+	params["value"] = value
+	params["contractAddress"] = contractAddress
+	params["methodName"] = methodName
+	params["methodDesc"] = methodDesc
+	params["args"] = args
+
+	result, err := this.CallPost("/api/contract/imputedgas/call", params)
+	if err != nil {
+		log.Errorf("get ImputedContractCallGas faield, err = %v \n", err)
+		return 0, err
 	}
-	body := make(map[string]interface{}, 0)
-	body["jsonrpc"] = "2.0"
-	body["id"] = id
-	body["method"] = method
-	body["params"] = params
 
-	if c.Debug {
-		log.Debug("Start Request API...")
+	gasLimit := result.Get("gasLimit")
+	if !gasLimit.Exists() || gasLimit.Uint() == 0 {
+		return 0, errors.New("imputed gas of contract call is empty")
 	}
 
-	r, err := req.Post(c.BaseURL+"/jsonrpc", req.BodyJSON(&body), authHeader)
+	return gasLimit.Uint(), nil
+}
 
-	if c.Debug {
-		log.Debug("Request API Completed")
+//InvokeContractView 调用合约的只读方法，返回方法的结果
+func (this *Client) InvokeContractView(contractAddress, methodName, methodDesc string, args []interface{}) (string, error) {
+	if this.isJSONRPC() {
+		return this.rpcInvokeContractView(contractAddress, methodName, methodDesc, args)
 	}
+	params := make(map[string]interface{})
+	params["contractAddress"] = contractAddress
+	params["methodName"] = methodName
+	params["methodDesc"] = methodDesc
+	params["args"] = args
 
-	if c.Debug {
-		log.Debugf("%+v\n", r)
+	result, err := this.CallPost("/api/contract/view", params)
+	if err != nil {
+		log.Errorf("InvokeContractView faield, err = %v \n", err)
+		return "", err
+	}
+
+	if !result.Get("result").Exists() {
+		return "", errors.New("result of contract view method is empty")
 	}
 
+	return result.Get("result").String(), nil
+}
+
+//GetAllowance 查询NRC20代币owner授权给spender的额度（最小单位）
+func (this *Client) GetAllowance(contractAddress, owner, spender string) (*big.Int, error) {
+	result, err := this.InvokeContractView(contractAddress, "allowance", "", []interface{}{owner, spender})
 	if err != nil {
 		return nil, err
 	}
 
-	resp := gjson.ParseBytes(r.Bytes())
-	err = isApiError(&resp)
+	allowance, ok := new(big.Int).SetString(result, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid allowance: %s", result)
+	}
+
+	return allowance, nil
+}
+
+//GetNrc721OwnerOf 查询NRC721的tokenId所有者
+func (this *Client) GetNrc721OwnerOf(contractAddress, tokenId string) (string, error) {
+	owner, err := this.InvokeContractView(contractAddress, "ownerOf", "", []interface{}{tokenId})
+	if err != nil {
+		return "", err
+	}
+
+	if len(owner) == 0 {
+		return "", fmt.Errorf("owner of token: %s is empty", tokenId)
+	}
+
+	return owner, nil
+}
+
+//GetNrc721Balance 查询地址持有的NRC721数量
+func (this *Client) GetNrc721Balance(contractAddress, address string) (*big.Int, error) {
+	result, err := this.InvokeContractView(contractAddress, "balanceOf", "", []interface{}{address})
 	if err != nil {
 		return nil, err
 	}
 
-	result := resp.Get("result")
+	balance, ok := new(big.Int).SetString(result, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid nrc721 balance: %s", result)
+	}
 
-	return &result, nil
+	return balance, nil
+}
+
+//GetContractPrice 获取合约调用的gas单价
+func (this *Client) GetContractPrice() (uint64, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetContractPrice()
+	}
+	result, err := this.CallReq("/api/contract/price")
+	if err != nil {
+		log.Errorf("get GetContractPrice faield, err = %v \n", err)
+		return 0, err
+	}
+
+	price := *result
+	if result.Type == gjson.JSON {
+		price = result.Get("price")
+	}
+
+	if price.Uint() == 0 {
+		return 0, errors.New("contract price is empty")
+	}
+
+	return price.Uint(), nil
+}
+
+func (c *Client) Call(method string, id int64, params []interface{}) (*gjson.Result, error) {
+	return c.CallContext(context.Background(), method, id, params)
+}
+
+//CallContext 调用JSON-RPC方法，可通过context取消，非幂等请求不重试
+func (c *Client) CallContext(ctx context.Context, method string, id int64, params []interface{}) (*gjson.Result, error) {
+	return c.callJSONRPC(ctx, method, id, params, false)
 }
 
 func (c *Client) CallPost(url string, params map[string]interface{}) (*gjson.Result, error) {
+	return c.CallPostContext(context.Background(), url, params)
+}
+
+//CallPostContext 发送POST请求，可通过context取消，非幂等请求不重试
+func (c *Client) CallPostContext(ctx context.Context, url string, params map[string]interface{}) (*gjson.Result, error) {
 	authHeader := req.Header{
 		"Accept":       "application/json",
 		"Content-Type": "application/json",
 	}
 
-	if c.Debug {
-		log.Debug("Start Request API...")
-	}
-
-	r, err := req.Post(c.BaseURL+url, req.BodyJSON(&params), authHeader)
+	r, err := c.doRequest(ctx, "POST", url, false, req.BodyJSON(&params), authHeader)
 
 	if err != nil {
 		return nil, err
 	}
-	if c.Debug {
-		log.Debug("Request API Completed")
-	}
 
 	if c.Debug {
 		log.Debugf("%+v\n", r)
@@ -465,28 +663,85 @@ func (c *Client) CallPost(url string, params map[string]interface{}) (*gjson.Res
 	return &result, nil
 }
 
-func (c *Client) CallReq(method string) (*gjson.Result, error) {
+//CallPostAll 向所有健康节点发送POST请求，返回第一个成功的结果
+func (c *Client) CallPostAll(url string, params map[string]interface{}) (*gjson.Result, error) {
+	authHeader := req.Header{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+	}
 
-	if c.Debug {
-		log.Debug("Start Request API...")
+	type postResult struct {
+		endpoint string
+		result   *gjson.Result
+		err      error
 	}
 
-	r, err := req.Get(c.BaseURL + method)
-	if err != nil {
-		return nil, err
+	urls := c.healthyEndpointURLs()
+	if len(urls) == 0 {
+		return c.CallPost(url, params)
 	}
-	if c.Debug {
-		log.Debug("Request API Completed")
+
+	results := make(chan postResult, len(urls))
+	for _, endpoint := range urls {
+		go func(endpoint string) {
+			r, err := c.doRequestURL(context.Background(), "POST", endpoint+url, false, req.BodyJSON(&params), authHeader)
+			if err != nil {
+				results <- postResult{endpoint: endpoint, err: err}
+				return
+			}
+			resp := gjson.ParseBytes(r.Bytes())
+			if err := isError(&resp); err != nil {
+				results <- postResult{endpoint: endpoint, err: err}
+				return
+			}
+			data := resp.Get("data")
+			results <- postResult{endpoint: endpoint, result: &data}
+		}(endpoint)
 	}
 
-	if c.Debug {
-		log.Debugf("%+v\n", r)
+	var (
+		found   *gjson.Result
+		lastErr error
+	)
+	for range urls {
+		r := <-results
+		if r.err != nil {
+			log.Warningf("request %s to endpoint: %s failed, err: %v", url, r.endpoint, r.err)
+			//优先返回节点的处理结果，而不是网络错误
+			if lastErr == nil || IsRetryable(lastErr) {
+				lastErr = r.err
+			}
+			continue
+		}
+		log.Infof("request %s served by endpoint: %s", url, r.endpoint)
+		if found == nil {
+			found = r.result
+		}
+	}
+
+	if found == nil {
+		return nil, lastErr
 	}
+	return found, nil
+}
+
+func (c *Client) CallReq(method string) (*gjson.Result, error) {
+	return c.CallReqContext(context.Background(), method)
+}
+
+//CallReqContext 发送GET请求，可通过context取消，失败时按退避策略重试
+func (c *Client) CallReqContext(ctx context.Context, method string) (*gjson.Result, error) {
+
+	r, err := c.doRequest(ctx, "GET", method, true)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if c.Debug {
+		log.Debugf("%+v\n", r)
+	}
+
 	resp := gjson.ParseBytes(r.Bytes())
 	err = isError(&resp)
 	if err != nil {
@@ -505,17 +760,15 @@ func isError(result *gjson.Result) error {
 	)
 
 	if !result.Get("success").Bool() {
-		errMsg := ""
 		if result != nil && result.Type == gjson.JSON {
-			errMsg = result.Get("msg").Raw
+			return parseNodeError(*result)
 		} else {
-			errMsg = "验签未知错误"
-			return errors.New("success is false! " + errMsg)
+			return newNodeError("", "验签未知错误")
 		}
 	}
 
 	if !result.Get("data").Exists() {
-		return errors.New("data is empty! ")
+		return &NodeError{Kind: ErrNotFound, Message: "data is empty! "}
 	}
 
 	return err
@@ -530,24 +783,28 @@ func isApiError(result *gjson.Result) error {
 	if !result.Get("error").IsObject() {
 
 		if !result.Get("result").Exists() {
-			return errors.New("Response is empty! ")
+			return &NodeError{Kind: ErrNotFound, Message: "Response is empty! "}
 		}
 
 		return nil
 	}
 
-	errInfo := fmt.Sprintf("[%d]%s",
-		result.Get("error.code").Int(),
-		result.Get("error.message").String())
-	err = errors.New(errInfo)
+	message := result.Get("error.message").String()
+	if data := result.Get("error.data"); data.Exists() {
+		message += " " + data.String()
+	}
+	err = newNodeError(result.Get("error.code").String(), message)
 
 	return err
 }
 
-//获取最新高度
-func (this *Client) GetAddressBalance(address string, assetId int64) (*Nuls2Balance, error) {
+//GetAddressBalance 获取地址指定资产的余额和nonce
+func (this *Client) GetAddressBalance(address string, assetChainId, assetId int64) (*Nuls2Balance, error) {
+	if this.isJSONRPC() {
+		return this.rpcGetAddressBalance(address, assetChainId, assetId)
+	}
 	params := make(map[string]interface{})
-	params["assetChainId"] = 1
+	params["assetChainId"] = assetChainId
 	params["assetId"] = assetId
 	target := "/api/accountledger/balance/" + address
 	result, err := this.CallPost(target, params)
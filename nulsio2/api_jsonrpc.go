@@ -0,0 +1,466 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/imroc/req"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	//浏览器REST接口
+	APIBackendREST = "rest"
+	//NULS 2.0 public-service 的JSON-RPC接口
+	APIBackendJSONRPC = "jsonrpc"
+
+	//JSON-RPC接口路径
+	jsonRPCPath = "/jsonrpc"
+
+	//计算确认数使用的最新高度的有效期，超时后重新查询
+	rpcBestHeightExpire = 10 * time.Second
+)
+
+//rpcRequestID JSON-RPC请求的自增id
+var rpcRequestID int64
+
+//isJSONRPC 是否使用public-service的JSON-RPC接口
+func (c *Client) isJSONRPC() bool {
+	return strings.EqualFold(c.Backend, APIBackendJSONRPC)
+}
+
+//chainId JSON-RPC接口的链ID参数
+func (c *Client) chainId() int64 {
+	if c.ChainId == 0 {
+		return MainAssetChainId
+	}
+	return c.ChainId
+}
+
+//callJSONRPC 调用JSON-RPC方法，retry为true时按退避策略重试，只用于查询方法
+func (c *Client) callJSONRPC(ctx context.Context, method string, id int64, params []interface{}, retry bool) (*gjson.Result, error) {
+	authHeader := req.Header{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+	}
+	body := make(map[string]interface{}, 0)
+	body["jsonrpc"] = "2.0"
+	body["id"] = id
+	body["method"] = method
+	body["params"] = params
+
+	r, err := c.doRequest(ctx, "POST", jsonRPCPath, retry, req.BodyJSON(&body), authHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Debug {
+		log.Debugf("%+v\n", r)
+	}
+
+	resp := gjson.ParseBytes(r.Bytes())
+	err = isApiError(&resp)
+	if err != nil {
+		return nil, err
+	}
+
+	result := resp.Get("result")
+
+	return &result, nil
+}
+
+//getEndpointHeightJSONRPC 通过getBestBlockHeader获取指定节点的最新高度，用于健康检查
+func (c *Client) getEndpointHeightJSONRPC(ctx context.Context, url string) (int64, error) {
+	authHeader := req.Header{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+	}
+	body := make(map[string]interface{}, 0)
+	body["jsonrpc"] = "2.0"
+	body["id"] = atomic.AddInt64(&rpcRequestID, 1)
+	body["method"] = "getBestBlockHeader"
+	body["params"] = []interface{}{c.chainId()}
+
+	r, err := c.doRequestURL(ctx, "POST", url+jsonRPCPath, false, req.BodyJSON(&body), authHeader)
+	if err != nil {
+		return 0, err
+	}
+
+	resp := gjson.ParseBytes(r.Bytes())
+	if err := isApiError(&resp); err != nil {
+		return 0, err
+	}
+
+	height := resp.Get("result.height")
+	if !height.Exists() {
+		return 0, errors.New("height of newest block is empty")
+	}
+
+	return height.Int(), nil
+}
+
+//rpcQuery 调用JSON-RPC查询方法，第一个参数为链ID
+func (c *Client) rpcQuery(method string, params ...interface{}) (*gjson.Result, error) {
+	result, err := c.callJSONRPC(context.Background(), method, atomic.AddInt64(&rpcRequestID, 1), append([]interface{}{c.chainId()}, params...), true)
+	if err != nil {
+		log.Errorf("%s faield, err = %v \n", method, err)
+		return nil, err
+	}
+	return result, nil
+}
+
+//rpcSend 调用JSON-RPC的非幂等方法，不重试
+func (c *Client) rpcSend(method string, params ...interface{}) (*gjson.Result, error) {
+	result, err := c.callJSONRPC(context.Background(), method, atomic.AddInt64(&rpcRequestID, 1), append([]interface{}{c.chainId()}, params...), false)
+	if err != nil {
+		log.Errorf("%s faield, err = %v \n", method, err)
+		return nil, err
+	}
+	return result, nil
+}
+
+//rpcTime public-service的时间戳可能为秒或毫秒，转为 "2006-01-02 15:04:05.000" 格式
+func rpcTime(t int64) string {
+	if t > 1e12 {
+		return time.Unix(0, t*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04:05.000")
+	}
+	return time.Unix(t, 0).UTC().Format("2006-01-02 15:04:05.000")
+}
+
+//rpcBlockHeader 解析public-service的区块头
+func rpcBlockHeader(header gjson.Result) *NusBlock {
+	return &NusBlock{
+		Hash:       header.Get("hash").String(),
+		Height:     header.Get("height").Int(),
+		Time:       rpcTime(header.Get("createTime").Int()),
+		PreHash:    header.Get("preHash").String(),
+		MerkleHash: header.Get("merkleHash").String(),
+		TxCount:    int32(header.Get("txCount").Int()),
+	}
+}
+
+//rpcConfirmCount 按最新高度计算交易的确认数，未打包的交易为0
+func rpcConfirmCount(height, bestHeight int64) int32 {
+	if height <= 0 {
+		return 0
+	}
+	if bestHeight < height {
+		return 1
+	}
+	return int32(bestHeight - height + 1)
+}
+
+//rpcTx 解析public-service的交易，bestHeight为最新高度，用于计算确认数
+func rpcTx(tx gjson.Result, bestHeight int64) *Tx {
+	result := &Tx{
+		Hash:        rpcString(tx, "txHash", "hash"),
+		BlockHeight: tx.Get("height").Int(),
+		Time:        rpcTime(tx.Get("createTime").Int()),
+		Type:        int32(tx.Get("type").Int()),
+		Status:      int(tx.Get("status").Int()),
+		Remark:      tx.Get("remark").String(),
+		Inputs:      make([]*Input, 0),
+		Outputs:     make([]*Output, 0),
+	}
+	result.ConfirmCount = rpcConfirmCount(result.BlockHeight, bestHeight)
+
+	for _, from := range tx.Get("coinFroms").Array() {
+		result.Inputs = append(result.Inputs, &Input{
+			Address:       from.Get("address").String(),
+			AssetsChainId: from.Get("chainId").Int(),
+			AssetsId:      from.Get("assetsId").Int(),
+			LockTime:      rpcField(from, "locked", "lockTime").Int(),
+			Amount:        from.Get("amount").String(),
+		})
+	}
+
+	for _, to := range tx.Get("coinTos").Array() {
+		result.Outputs = append(result.Outputs, &Output{
+			Address:       to.Get("address").String(),
+			AssetsChainId: to.Get("chainId").Int(),
+			AssetsId:      to.Get("assetsId").Int(),
+			LockTime:      to.Get("lockTime").Int(),
+			Amount:        to.Get("amount").String(),
+		})
+	}
+
+	return result
+}
+
+//rpcBlock 解析public-service的区块及交易
+func rpcBlock(block gjson.Result, bestHeight int64) (*NusBlock, error) {
+	header := rpcField(block, "header", "blockHeader")
+	if !header.Exists() {
+		return nil, errors.New("block header is empty")
+	}
+
+	nusBlock := rpcBlockHeader(header)
+	nusBlock.TxList = make([]*Tx, 0)
+	for _, tx := range block.Get("txList").Array() {
+		nusBlock.TxList = append(nusBlock.TxList, rpcTx(tx, bestHeight))
+	}
+
+	return nusBlock, nil
+}
+
+//rpcField 按顺序取第一个存在的字段，兼容不同版本的字段名
+func rpcField(result gjson.Result, keys ...string) gjson.Result {
+	for _, key := range keys {
+		if v := result.Get(key); v.Exists() {
+			return v
+		}
+	}
+	return gjson.Result{}
+}
+
+//rpcString 按顺序取第一个存在的字段的字符串值
+func rpcString(result gjson.Result, keys ...string) string {
+	return rpcField(result, keys...).String()
+}
+
+//rpcNulsToken 解析public-service的代币转账
+func rpcNulsToken(hash, protocol string, transfer gjson.Result) *NulsToken {
+	return &NulsToken{
+		Hash:            hash,
+		ContractAddress: transfer.Get("contractAddress").String(),
+		From:            rpcString(transfer, "fromAddress", "from"),
+		To:              rpcString(transfer, "toAddress", "to"),
+		Value:           transfer.Get("value").String(),
+		Name:            transfer.Get("name").String(),
+		Symbol:          transfer.Get("symbol").String(),
+		Decimals:        transfer.Get("decimals").Int(),
+		TokenId:         transfer.Get("tokenId").String(),
+		Protocol:        protocol,
+	}
+}
+
+func (this *Client) rpcGetNewBlock() (*NusBlock, error) {
+	result, err := this.rpcQuery("getBestBlockHeader")
+	if err != nil {
+		return nil, err
+	}
+	if !result.Get("hash").Exists() {
+		return nil, errors.New("result of getBestBlockHeader is empty")
+	}
+	header := rpcBlockHeader(*result)
+	atomic.StoreInt64(&this.bestHeight, header.Height)
+	atomic.StoreInt64(&this.bestHeightTime, time.Now().UnixNano())
+	return header, nil
+}
+
+//rpcBestHeight 最新区块高度，优先使用扫描时获取的高度，避免每次查询区块和交易都多请求一次
+func (this *Client) rpcBestHeight() (int64, error) {
+	if height := atomic.LoadInt64(&this.bestHeight); height > 0 &&
+		time.Now().UnixNano()-atomic.LoadInt64(&this.bestHeightTime) < int64(rpcBestHeightExpire) {
+		return height, nil
+	}
+	header, err := this.rpcGetNewBlock()
+	if err != nil {
+		return 0, err
+	}
+	return header.Height, nil
+}
+
+func (this *Client) rpcGetBlockByHeight(height int64) (*NusBlock, error) {
+	result, err := this.rpcQuery("getBlockByHeight", height)
+	if err != nil {
+		return nil, err
+	}
+	bestHeight, err := this.rpcBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	return rpcBlock(*result, bestHeight)
+}
+
+func (this *Client) rpcGetBlockByHash(hash string) (*NusBlock, error) {
+	result, err := this.rpcQuery("getBlockByHash", hash)
+	if err != nil {
+		return nil, err
+	}
+	bestHeight, err := this.rpcBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	return rpcBlock(*result, bestHeight)
+}
+
+func (this *Client) rpcGetTxByTxId(txId string) (*Tx, error) {
+	result, err := this.rpcQuery("getTx", txId)
+	if err != nil {
+		return nil, err
+	}
+	if len(rpcString(*result, "txHash", "hash")) == 0 {
+		return nil, &NodeError{Kind: ErrNotFound, Message: "can not find tx: " + txId}
+	}
+	bestHeight, err := this.rpcBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	return rpcTx(*result, bestHeight), nil
+}
+
+func (this *Client) rpcGetAddressBalance(address string, assetChainId, assetId int64) (*Nuls2Balance, error) {
+	result, err := this.rpcQuery("getAccountBalance", assetChainId, assetId, address)
+	if err != nil {
+		return nil, err
+	}
+	if result.Type != gjson.JSON {
+		return nil, errors.New("result of getAccountBalance type error")
+	}
+	return &Nuls2Balance{
+		Total:         result.Get("totalBalance").String(),
+		Freeze:        result.Get("freeze").String(),
+		Available:     result.Get("balance").String(),
+		TimeLock:      result.Get("timeLock").String(),
+		ConsensusLock: result.Get("consensusLock").String(),
+		Nonce:         result.Get("nonce").String(),
+		NonceType:     result.Get("nonceType").Int(),
+	}, nil
+}
+
+func (this *Client) rpcGetTokenBalance(contractAddress, address string) (*TokenBalance, error) {
+	result, err := this.rpcQuery("getAccountTokenBalance", contractAddress, address)
+	if err != nil {
+		return nil, err
+	}
+	if result.Type != gjson.JSON {
+		return nil, errors.New("result of getAccountTokenBalance type error")
+	}
+	return &TokenBalance{
+		ContractAddress: contractAddress,
+		Amount:          rpcString(*result, "balance", "amount"),
+		Decimals:        result.Get("decimals").Uint(),
+	}, nil
+}
+
+func (this *Client) rpcGetContractResult(hash string) (*ContractResult, error) {
+	result, err := this.rpcQuery("getContractTxResult", hash)
+	if err != nil {
+		return nil, err
+	}
+	if result.Type != gjson.JSON {
+		return nil, errors.New("result of getContractTxResult type error")
+	}
+
+	contractResult := &ContractResult{
+		Hash:              hash,
+		Success:           result.Get("success").Bool(),
+		ErrorMessage:      result.Get("errorMessage").String(),
+		TokenTransfers:    make([]*NulsToken, 0),
+		Token721Transfers: make([]*NulsToken, 0),
+		Transfers:         make([]*ContractTransfer, 0),
+		TotalFee:          json.Number(result.Get("totalFee").String()),
+		TxSizeFee:         json.Number(result.Get("txSizeFee").String()),
+		ActualContractFee: json.Number(result.Get("actualContractFee").String()),
+		RefundFee:         json.Number(result.Get("refundFee").String()),
+	}
+
+	for _, transfer := range result.Get("tokenTransfers").Array() {
+		contractResult.TokenTransfers = append(contractResult.TokenTransfers, rpcNulsToken(hash, Nrc20Protocol, transfer))
+	}
+
+	for _, transfer := range result.Get("token721Transfers").Array() {
+		contractResult.Token721Transfers = append(contractResult.Token721Transfers, rpcNulsToken(hash, Nrc721Protocol, transfer))
+	}
+
+	transfers := rpcField(*result, "transfers", "nulsTransfers")
+	for _, transfer := range transfers.Array() {
+		contractTransfer := &ContractTransfer{
+			TxHash:      transfer.Get("txHash").String(),
+			From:        rpcString(transfer, "fromAddress", "from"),
+			Value:       transfer.Get("value").String(),
+			Outputs:     make([]*ContractTransferOutput, 0),
+			OrginTxHash: transfer.Get("orginTxHash").String(),
+		}
+		for _, output := range transfer.Get("outputs").Array() {
+			contractTransfer.Outputs = append(contractTransfer.Outputs, &ContractTransferOutput{
+				To:    rpcString(output, "to", "address"),
+				Value: output.Get("value").String(),
+			})
+		}
+		contractResult.Transfers = append(contractResult.Transfers, contractTransfer)
+	}
+
+	return contractResult, nil
+}
+
+func (this *Client) rpcValidateTransaction(hex string) (bool, error) {
+	result, err := this.rpcQuery("validateTx", hex)
+	if err != nil {
+		return false, err
+	}
+	if result.Get("value").Exists() {
+		return true, nil
+	}
+	return false, parseNodeError(*result)
+}
+
+func (this *Client) rpcSendRawTransaction(hex string) (string, error) {
+	result, err := this.rpcSend("broadcastTx", hex)
+	if err != nil {
+		return "", err
+	}
+	if !result.Get("value").Bool() {
+		return "", parseNodeError(*result)
+	}
+	return result.Get("hash").String(), nil
+}
+
+func (this *Client) rpcImputedContractCallGas(sender string, value *big.Int, contractAddress, methodName, methodDesc string, args []interface{}) (uint64, error) {
+	result, err := this.rpcQuery("imputedContractCallGas", sender, value, contractAddress, methodName, methodDesc, args)
+	if err != nil {
+		return 0, err
+	}
+	gasLimit := result.Get("gasLimit")
+	if !gasLimit.Exists() || gasLimit.Uint() == 0 {
+		return 0, errors.New("imputed gas of contract call is empty")
+	}
+	return gasLimit.Uint(), nil
+}
+
+func (this *Client) rpcGetContractPrice() (uint64, error) {
+	result, err := this.rpcQuery("imputedPrice")
+	if err != nil {
+		return 0, err
+	}
+	price := *result
+	if result.Type == gjson.JSON {
+		price = result.Get("price")
+	}
+	if price.Uint() == 0 {
+		return 0, errors.New("contract price is empty")
+	}
+	return price.Uint(), nil
+}
+
+func (this *Client) rpcInvokeContractView(contractAddress, methodName, methodDesc string, args []interface{}) (string, error) {
+	result, err := this.rpcQuery("invokeView", contractAddress, methodName, methodDesc, args)
+	if err != nil {
+		return "", err
+	}
+	if !result.Get("result").Exists() {
+		return "", errors.New("result of contract view method is empty")
+	}
+	return result.Get("result").String(), nil
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/astaxie/beego/config"
+	"github.com/tidwall/gjson"
+)
+
+//rpcRequest 测试节点收到的JSON-RPC请求
+type rpcRequest struct {
+	Version string            `json:"jsonrpc"`
+	ID      int64             `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+//rpcServer 测试用的public-service节点，按方法名返回result或error的原始JSON
+type rpcServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []rpcRequest
+}
+
+func newRPCServer(t *testing.T, responses map[string]string) *rpcServer {
+	s := &rpcServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != jsonRPCPath || r.Method != "POST" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		var request rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode request failed, unexpected error: %v", err)
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, request)
+		s.mu.Unlock()
+
+		response, ok := responses[request.Method]
+		if !ok {
+			response = `"error":{"code":-32601,"message":"method not found"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,%s}`, request.ID, response)
+	}))
+	return s
+}
+
+//methods 收到的请求方法
+func (s *rpcServer) methods() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make([]string, 0, len(s.requests))
+	for _, r := range s.requests {
+		methods = append(methods, r.Method)
+	}
+	return methods
+}
+
+func newRPCClient(url string) *Client {
+	client := newTestClient(url)
+	client.Backend = APIBackendJSONRPC
+	client.ChainId = 2
+	return client
+}
+
+func TestCallJSONRPC_Envelope(t *testing.T) {
+	server := newRPCServer(t, map[string]string{
+		"getAccountBalance": `"result":{"totalBalance":"123000000000000000000","balance":"100","nonce":"0102030405060708"}`,
+	})
+	defer server.Close()
+
+	client := newRPCClient(server.URL)
+	balance, err := client.GetAddressBalance("tNULSeBaMtest", 2, 5)
+	if err != nil {
+		t.Fatalf("GetAddressBalance failed, unexpected error: %v", err)
+	}
+	if balance.Total != "123000000000000000000" || balance.Nonce != "0102030405060708" {
+		t.Errorf("unexpected balance: %+v", balance)
+	}
+
+	if len(server.requests) != 1 {
+		t.Fatalf("unexpected request count: %d", len(server.requests))
+	}
+	request := server.requests[0]
+	if request.Version != "2.0" || request.ID == 0 || request.Method != "getAccountBalance" {
+		t.Errorf("unexpected request envelope: %+v", request)
+	}
+
+	//第一个参数为链ID
+	params := make([]string, 0, len(request.Params))
+	for _, p := range request.Params {
+		params = append(params, string(p))
+	}
+	expected := []string{"2", "2", "5", `"tNULSeBaMtest"`}
+	if fmt.Sprint(params) != fmt.Sprint(expected) {
+		t.Errorf("unexpected params: %v", params)
+	}
+}
+
+func TestCallJSONRPC_Error(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		kind     error
+		code     string
+	}{
+		{"code", `"error":{"code":"tx_0013","message":"Transaction already exists"}`, ErrTxExists, "tx_0013"},
+		{"code precedence", `"error":{"code":"lg_0004","message":"unknown"}`, ErrInsufficientBalance, "lg_0004"},
+		{"message", `"error":{"code":-32000,"message":"fee not enough"}`, ErrInsufficientFee, "-32000"},
+		{"error data", `"error":{"code":-32000,"message":"validate failed","data":"nonce error"}`, ErrNonceConflict, "-32000"},
+		{"unknown", `"error":{"code":-32602,"message":"invalid params"}`, ErrNodeResponse, "-32602"},
+		{"empty result", `"result":null`, ErrNotFound, ""},
+	}
+
+	for _, c := range cases {
+		server := newRPCServer(t, map[string]string{"getTx": c.response})
+		client := newRPCClient(server.URL)
+
+		_, err := client.GetTxByTxId("abc")
+		server.Close()
+
+		if !IsNodeError(err, c.kind) {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		var nodeErr *NodeError
+		if !errors.As(err, &nodeErr) || nodeErr.Code != c.code {
+			t.Errorf("%s: unexpected error code: %v", c.name, err)
+		}
+		if IsRetryable(err) {
+			t.Errorf("%s: node response error should not be retried", c.name)
+		}
+	}
+}
+
+func TestGetTxByTxId_JSONRPC(t *testing.T) {
+	server := newRPCServer(t, map[string]string{
+		"getTx": `"result":{"txHash":"abc","height":90,"createTime":1600000000000,"type":2,"status":1,
+			"coinFroms":[{"address":"a","chainId":2,"assetsId":1,"amount":"100100000","locked":0}],
+			"coinTos":[{"address":"b","chainId":2,"assetsId":1,"amount":"100000000","lockTime":0}]}`,
+		"getBestBlockHeader": `"result":{"hash":"def","height":100}`,
+	})
+	defer server.Close()
+
+	client := newRPCClient(server.URL)
+	tx, err := client.GetTxByTxId("abc")
+	if err != nil {
+		t.Fatalf("GetTxByTxId failed, unexpected error: %v", err)
+	}
+	if tx.Hash != "abc" || tx.BlockHeight != 90 || tx.ConfirmCount != 11 || tx.Time != "2020-09-13 12:26:40.000" {
+		t.Errorf("unexpected tx: %+v", tx)
+	}
+	if len(tx.Inputs) != 1 || tx.Inputs[0].Amount != "100100000" || len(tx.Outputs) != 1 || tx.Outputs[0].Address != "b" {
+		t.Errorf("unexpected coins of tx: %+v", tx)
+	}
+
+	//最新高度在有效期内复用，不再重复请求
+	if _, err := client.GetTxByTxId("abc"); err != nil {
+		t.Fatalf("GetTxByTxId failed, unexpected error: %v", err)
+	}
+	if methods := server.methods(); fmt.Sprint(methods) != "[getTx getBestBlockHeader getTx]" {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+}
+
+func TestRPCBestHeight(t *testing.T) {
+	server := newRPCServer(t, map[string]string{
+		"getBlockByHeight":   `"result":{"header":{"hash":"h90","height":90},"txList":[{"txHash":"abc","height":90,"type":2}]}`,
+		"getBestBlockHeader": `"result":{"hash":"def","height":100}`,
+	})
+	defer server.Close()
+
+	//扫描时获取的最新高度用于计算确认数
+	client := newRPCClient(server.URL)
+	if _, err := client.GetNewHeight(); err != nil {
+		t.Fatalf("GetNewHeight failed, unexpected error: %v", err)
+	}
+	block, err := client.GetBlockByHeight(90)
+	if err != nil {
+		t.Fatalf("GetBlockByHeight failed, unexpected error: %v", err)
+	}
+	if len(block.TxList) != 1 || block.TxList[0].ConfirmCount != 11 {
+		t.Errorf("unexpected txs of block: %+v", block.TxList)
+	}
+	if methods := server.methods(); fmt.Sprint(methods) != "[getBestBlockHeader getBlockByHeight]" {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+
+	//超过有效期后重新查询
+	client.bestHeightTime -= int64(rpcBestHeightExpire)
+	if _, err := client.GetBlockByHeight(90); err != nil {
+		t.Fatalf("GetBlockByHeight failed, unexpected error: %v", err)
+	}
+	if methods := server.methods(); len(methods) != 4 || methods[3] != "getBestBlockHeader" {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+}
+
+func TestRPCConfirmCount(t *testing.T) {
+	cases := []struct {
+		height, bestHeight int64
+		confirm            int32
+	}{
+		{0, 100, 0},
+		{100, 100, 1},
+		{90, 100, 11},
+		//节点落后时已打包的交易至少1个确认
+		{101, 100, 1},
+	}
+	for _, c := range cases {
+		if confirm := rpcConfirmCount(c.height, c.bestHeight); confirm != c.confirm {
+			t.Errorf("height %d of best %d: unexpected confirm count: %d", c.height, c.bestHeight, confirm)
+		}
+	}
+}
+
+func TestLoadAssetsConfig_ScanMemPool(t *testing.T) {
+	cases := []struct {
+		backend     string
+		scanMemPool bool
+		fail        bool
+	}{
+		{APIBackendREST, true, false},
+		{APIBackendJSONRPC, false, false},
+		//jsonrpc接口不支持交易池扫描
+		{APIBackendJSONRPC, true, true},
+	}
+
+	for _, c := range cases {
+		conf := fmt.Sprintf("serverAPI = http://127.0.0.1:18003\napiBackend = %s\nchainId = 1\nscanMemPool = %v\n", c.backend, c.scanMemPool)
+		configer, err := config.NewConfigData("ini", []byte(conf))
+		if err != nil {
+			t.Fatalf("NewConfigData failed, unexpected error: %v", err)
+		}
+
+		wm := NewWalletManager()
+		err = wm.LoadAssetsConfig(configer)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: scanMemPool should be rejected", c.backend)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: LoadAssetsConfig failed, unexpected error: %v", c.backend, err)
+			continue
+		}
+		if wm.Blockscanner.IsScanMemPool != c.scanMemPool {
+			t.Errorf("%s: unexpected scanMemPool: %v", c.backend, wm.Blockscanner.IsScanMemPool)
+		}
+	}
+}
+
+func TestGetContractPrice_JSONRPC(t *testing.T) {
+	server := newRPCServer(t, map[string]string{"imputedPrice": `"result":30`})
+	defer server.Close()
+
+	client := newRPCClient(server.URL)
+	price, err := client.GetContractPrice()
+	if err != nil {
+		t.Fatalf("GetContractPrice failed, unexpected error: %v", err)
+	}
+	if price != 30 {
+		t.Errorf("unexpected price: %d", price)
+	}
+}
+
+func TestCheckEndpoints_JSONRPC(t *testing.T) {
+	best := newRPCServer(t, map[string]string{"getBestBlockHeader": `"result":{"hash":"a","height":100}`})
+	defer best.Close()
+	lagging := newRPCServer(t, map[string]string{"getBestBlockHeader": `"result":{"hash":"b","height":50}`})
+	defer lagging.Close()
+
+	client := newRPCClient("")
+	client.SetEndpoints([]*Endpoint{{URL: lagging.URL}, {URL: best.URL, Priority: 1}})
+	client.CheckEndpoints(context.Background())
+
+	if healthy := client.healthyEndpointURLs(); len(healthy) != 1 || healthy[0] != best.URL {
+		t.Errorf("unexpected healthy endpoints: %v", healthy)
+	}
+	if methods := lagging.methods(); len(methods) != 1 || methods[0] != "getBestBlockHeader" {
+		t.Errorf("unexpected health check methods: %v", methods)
+	}
+}
+
+func TestParseNodeError(t *testing.T) {
+	cases := []struct {
+		raw  string
+		kind error
+	}{
+		//浏览器接口的错误格式
+		{`{"code":"tx_0003","msg":"unknown"}`, ErrInsufficientFee},
+		{`{"data":{"code":"err_0001","msg":"balance not enough"}}`, ErrInsufficientBalance},
+		{`{"code":"err_0001","message":"insufficient fee"}`, ErrInsufficientFee},
+		//包含fee但不是手续费不足
+		{`{"code":"err_0001","msg":"fee address is invalid"}`, ErrNodeResponse},
+		{`{"code":"err_0001","msg":"signature verify failed"}`, ErrInvalidSignature},
+		{`"tx not exist"`, ErrNotFound},
+	}
+	for _, c := range cases {
+		err := parseNodeError(gjson.Parse(c.raw))
+		if !IsNodeError(err, c.kind) {
+			t.Errorf("%s: unexpected error: %v", c.raw, err)
+		}
+	}
+
+	//包装后的错误仍可判断类型
+	wrapped := fmt.Errorf("broadcast failed: %w", newNodeError("tx_0013", ""))
+	if !IsNodeError(wrapped, ErrTxExists) || IsNodeError(wrapped, ErrNotFound) {
+		t.Errorf("unexpected wrapped error: %v", wrapped)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	//主链资产
+	MainAssetChainId = int64(1)
+	MainAssetId      = int64(1)
+
+	//链上资产的合约协议，合约地址格式为 "assetChainId-assetId"
+	AssetProtocol = "asset"
+)
+
+//NulsAsset 链上资产标识
+type NulsAsset struct {
+	ChainId  int64
+	AssetId  int64
+	Decimals int32
+}
+
+//IsMainAsset 是否主链资产
+func (a *NulsAsset) IsMainAsset() bool {
+	return a.ChainId == MainAssetChainId && a.AssetId == MainAssetId
+}
+
+//String 资产标识，格式为 "assetChainId-assetId"
+func (a *NulsAsset) String() string {
+	return fmt.Sprintf("%d-%d", a.ChainId, a.AssetId)
+}
+
+//ParseAsset 解析 "assetChainId-assetId" 格式的资产标识
+func ParseAsset(s string) (*NulsAsset, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid asset: %s", s)
+	}
+
+	chainId, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || chainId == 0 {
+		return nil, fmt.Errorf("invalid asset chain id: %s", s)
+	}
+
+	assetId, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil || assetId == 0 {
+		return nil, fmt.Errorf("invalid asset id: %s", s)
+	}
+
+	return &NulsAsset{ChainId: int64(chainId), AssetId: int64(assetId)}, nil
+}
+
+//IsAssetContract 合约是否代表链上资产
+func IsAssetContract(contract openwallet.SmartContract) bool {
+	return strings.EqualFold(contract.Protocol, AssetProtocol)
+}
+
+//getCoinAsset 获取币种对应的链上资产，非链上资产的币种使用主链资产
+func (wm *WalletManager) getCoinAsset(coin openwallet.Coin) (*NulsAsset, error) {
+	if !coin.IsContract || !IsAssetContract(coin.Contract) {
+		return &NulsAsset{ChainId: MainAssetChainId, AssetId: MainAssetId, Decimals: wm.Decimal()}, nil
+	}
+
+	asset, err := ParseAsset(coin.Contract.Address)
+	if err != nil {
+		return nil, err
+	}
+	asset.Decimals = int32(coin.Contract.Decimals)
+
+	return asset, nil
+}
+
+//getAssetBalance 获取地址链上资产的可用余额（最小单位）
+func (wm *WalletManager) getAssetBalance(assetKey, address string) (decimal.Decimal, error) {
+	asset, err := ParseAsset(assetKey)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	balance, err := wm.Api.GetAddressBalance(address, asset.ChainId, asset.AssetId)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return decimal.NewFromString(balance.Available)
+}
@@ -33,17 +33,20 @@ const (
 //NULSBlockScanner nulscoin的区块链扫描器
 type NULSBlockScanner struct {
 	*openwallet.BlockScannerBase
-	CurrentBlockHeight   uint64         //当前区块高度
-	extractingCH         chan struct{}  //扫描工作令牌
-	wm                   *WalletManager //钱包管理者
-	IsScanMemPool        bool           //是否扫描交易池
-	RescanLastBlockCount uint64         //重扫上N个区块数量
+	CurrentBlockHeight   uint64               //当前区块高度
+	extractingCH         chan struct{}        //扫描工作令牌
+	wm                   *WalletManager       //钱包管理者
+	IsScanMemPool        bool                 //是否扫描交易池
+	RescanLastBlockCount uint64               //重扫上N个区块数量
+	memPool              *memPoolCache        //已通知的交易池交易
+	confirmTracker       *confirmationTracker //未达到确认数的交易
 }
 
 //ExtractResult 扫描完成的提取结果
 type ExtractResult struct {
 	extractData         map[string]*openwallet.TxExtractData
 	extractContractData map[string]*openwallet.TxExtractData //代币交易
+	extractTransferData []map[string]*openwallet.TxExtractData //合约内部转账，每笔转账一个交易单
 	TxID                string
 	BlockHeight         uint64
 	Success             bool
@@ -65,6 +68,8 @@ func NewNULSBlockScanner(wm *WalletManager) *NULSBlockScanner {
 	bs.extractingCH = make(chan struct{}, maxExtractingSize)
 	bs.wm = wm
 	bs.IsScanMemPool = false
+	bs.memPool = newMemPoolCache()
+	bs.confirmTracker = newConfirmationTracker()
 	bs.RescanLastBlockCount = 5
 
 	//设置扫描任务
@@ -102,6 +107,9 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 		return
 	}
 
+	//恢复重启前未达到确认数的交易
+	bs.restoreConfirmations(currentHeight)
+
 	if currentHeight == 0 {
 		bs.wm.Log.Std.Info("No records found in local, get current block as the local!")
 
@@ -114,6 +122,9 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 		currentHeight = uint64(headBlock.Height - 1)
 	}
 
+	//并发预取的区块
+	var prefetched map[uint64]*prefetchedBlock
+
 
 	for {
 
@@ -141,24 +152,42 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 
 		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
 
-		hashResult, err := bs.wm.GetBlockHash(currentHeight)
-		if err != nil {
-			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
-			break
+		//落后较多时并发预取后续区块，接近最新高度时逐个获取
+		if len(prefetched) == 0 {
+			if window := bs.catchUpWindow(currentHeight-1, maxHeight); window > 0 {
+				prefetched = bs.prefetchBlocks(currentHeight, window)
+			}
 		}
 
-		hash := hashResult.Hash
+		var (
+			hash  string
+			block *NusBlock
+		)
 
-		block, err := bs.wm.GetBlock(hash)
-		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+		if pb, ok := prefetched[currentHeight]; ok {
+			delete(prefetched, currentHeight)
+			hash = pb.hash
+			block = pb.block
+		} else {
+			hashResult, err := bs.wm.GetBlockHash(currentHeight)
+			if err != nil {
+				//下一个高度找不到会报异常
+				bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
+				break
+			}
 
-			//记录未扫区块
-			unscanRecord := NewUnscanRecord(currentHeight, "", err.Error())
-			bs.SaveUnscanRecord(unscanRecord)
-			bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
-			continue
+			hash = hashResult.Hash
+
+			block, err = bs.wm.GetBlock(hash)
+			if err != nil {
+				bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+
+				//记录未扫区块
+				unscanRecord := NewUnscanRecord(currentHeight, "", err.Error())
+				bs.SaveUnscanRecord(unscanRecord)
+				bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
+				continue
+			}
 		}
 
 		isFork := false
@@ -170,51 +199,37 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
 			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.PreHash)
 
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
-
-			//查询本地分叉的区块
-			forkBlock, _ := bs.GetLocalBlock(uint32(currentHeight - 1))
-
-			//删除上一区块链的所有充值记录
-			//bs.DeleteRechargesByHeight(currentHeight - 1)
-			//删除上一区块链的未扫记录
-			bs.DeleteUnscanRecord(uint32(currentHeight - 1))
-			currentHeight = currentHeight - 2 //倒退2个区块重新扫描
-			if currentHeight <= 0 {
-				currentHeight = 1
-			}
+			//分叉后预取的区块作废
+			prefetched = nil
 
-			localBlock, err := bs.GetLocalBlock(uint32(currentHeight))
+			//向前查找与主链相同的共同祖先区块，之后的本地区块都已分叉
+			ancestor, forkBlocks, err := bs.findForkAncestor(currentHeight - 1)
 			if err != nil {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
-
-				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+				bs.wm.Log.Std.Error("block scanner can not find fork ancestor; unexpected error: %v", err)
+				break
+			}
 
-				localBlock2, err := bs.wm.GetBlockHash(currentHeight)
-				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
-				}
+			isFork = true
 
-				localBlock = localBlock2.ToBlock()
+			//按高度从高到低通知分叉区块给观测者，异步处理
+			for _, forkBlock := range forkBlocks {
+				bs.wm.Log.Std.Info("delete recharge records on block height: %d.", forkBlock.Height)
+				//删除分叉区块的未扫记录
+				bs.DeleteUnscanRecord(forkBlock.Height)
+				bs.newBlockNotify(forkBlock, isFork)
 			}
 
-			//重置当前区块的hash
-			currentHash = localBlock.Hash
+			//从共同祖先区块开始重新扫描
+			currentHeight = uint64(ancestor.Height)
+			currentHash = ancestor.Hash
+
+			//分叉区块中的交易不再等待确认
+			bs.dropConfirmations(currentHeight)
 
 			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
 
 			//重新记录一个新扫描起点
-			bs.SaveLocalBlockHead(uint32(localBlock.Height), localBlock.Hash)
-
-			isFork = true
-
-			if forkBlock != nil {
-
-				//通知分叉区块给观测者，异步处理
-				bs.newBlockNotify(forkBlock, isFork)
-			}
+			bs.SaveLocalBlockHead(ancestor.Height, ancestor.Hash)
 
 		} else {
 
@@ -234,6 +249,9 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 
 			//通知新区块给观测者，异步处理
 			bs.newBlockNotify(block.ToBlock(), isFork)
+
+			//通知达到确认数的交易
+			bs.notifyConfirmedTxs(currentHeight)
 		}
 
 	}
@@ -243,10 +261,10 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 		bs.scanBlock(i)
 	}
 
-	//if bs.IsScanMemPool {
-	//	//扫描交易内存池
-	//	bs.ScanTxMemPool()
-	//}
+	if bs.IsScanMemPool {
+		//扫描交易内存池
+		bs.ScanTxMemPool()
+	}
 
 	//重扫失败区块
 	bs.RescanFailedRecord()
@@ -382,6 +400,9 @@ func (bs *NULSBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 		return fmt.Errorf("BatchExtractTransaction block is nil.")
 	}
 
+	//已扫描高度，用于计算重扫区块中交易的确认数
+	scannedHeight := bs.GetScannedBlockHeight()
+
 	//生产通道
 	producer := make(chan ExtractResult)
 	defer close(producer)
@@ -397,6 +418,13 @@ func (bs *NULSBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 
 			if gets.Success {
 
+				//首次通知前记录需要多个确认的交易
+				bs.trackConfirmations(height, scannedHeight, gets.extractData)
+				bs.trackConfirmations(height, scannedHeight, gets.extractContractData)
+				for _, transferData := range gets.extractTransferData {
+					bs.trackConfirmations(height, scannedHeight, transferData)
+				}
+
 				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
 				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
 				if notifyErr != nil {
@@ -411,6 +439,14 @@ func (bs *NULSBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
 				}
 
+				for _, transferData := range gets.extractTransferData {
+					notifyErr = bs.newExtractDataNotify(height, transferData)
+					if notifyErr != nil {
+						failed++ //标记保存失败数
+						bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+					}
+				}
+
 			} else {
 				//记录未扫区块
 				unscanRecord := NewUnscanRecord(height, "", "")
@@ -517,6 +553,11 @@ func (bs *NULSBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 
 	//bs.wm.Log.Debug("start extractTransaction")
 
+	//已上链的交易，交易池扫描不再作为未确认交易通知
+	if bs.IsScanMemPool && tx != nil {
+		bs.memPool.confirm(tx.Hash)
+	}
+
 	bs.extractTransaction(tx, blockHash, &result, ScanTargetFunc)
 
 	bs.extractTokenTransaction(tx, blockHash, &result, ScanTargetFunc)
@@ -541,23 +582,23 @@ func (bs *NULSBlockScanner) extractTransaction(trx *Tx, blockHash string, result
 
 		blocktime := trx.GetTime()
 
-		if trx.Type == 2 || trx.Type == 16 {
+		nulsTxType := GetNulsTxType(trx.Type)
+		if nulsTxType == nil {
+			bs.wm.Log.Warningf("unknown tx type: %d, txid: %s", trx.Type, trx.Hash)
+		}
 
-			txType := 1
-			if trx.Type == 2 {
-				txType = 0
-			} else if trx.Type == 16 {
-				txType = 1
-			}
+		if nulsTxType != nil && nulsTxType.Extract {
+
+			txType := nulsTxType.TxType
 			//提取出账部分记录
 			from, totalSpent := bs.extractTxInput(trx, blockHash, result, ScanTargetFunc, uint64(txType))
 			//bs.wm.Log.Debug("from:", from, "totalSpent:", totalSpent)
 
 			//提取入账部分记录
-			to, totalReceived := bs.extractTxOutput(trx, blockHash, result, ScanTargetFunc, uint64(txType))
+			to, totalReceived, lockedAmounts := bs.extractTxOutput(trx, blockHash, result, ScanTargetFunc, uint64(txType))
 			//bs.wm.Log.Debug("to:", to, "totalReceived:", totalReceived)
 
-			for _, extractData := range result.extractData {
+			for sourceKey, extractData := range result.extractData {
 				tx := &openwallet.Transaction{
 					From: from,
 					To:   to,
@@ -572,7 +613,13 @@ func (bs *NULSBlockScanner) extractTransaction(trx *Tx, blockHash string, result
 					Decimal:     8,
 					ConfirmTime: blocktime,
 					Status:      openwallet.TxStatusSuccess,
-					TxType:      uint64(txType),
+					TxType:      txType,
+					TxAction:    nulsTxType.Name,
+				}
+				setTransactionRemark(tx, trx.Remark)
+				//只统计该账户监听地址收到的锁定金额
+				if locked := lockedAmounts[sourceKey]; locked.GreaterThan(decimal.Zero) {
+					tx.SetExtParam("lockedAmount", locked.StringFixed(bs.wm.Decimal()))
 				}
 				wxID := openwallet.GenTransactionWxID(tx)
 				tx.WxID = wxID
@@ -605,24 +652,37 @@ func (bs *NULSBlockScanner) extractTokenTransaction(trx *Tx, blockHash string, r
 		if success {
 
 			switch trx.Type {
-			case 16:
-				tokenTrans, err := bs.wm.Api.GetTokenByHash(trx.Hash)
+			case TxTypeCallContract:
+				contractResult, err := bs.wm.Api.GetContractResult(trx.Hash)
 				if err != nil {
 					bs.wm.Log.Error("Token tokenTrans is nil,hash:", trx.Hash, " ,err:", err.Error())
 					break
 				}
+				if !contractResult.Success {
+					//合约执行失败，只扣除手续费
+					bs.wm.Log.Warningf("contract call is not success, hash: %s, err: %s", trx.Hash, contractResult.ErrorMessage)
+					bs.setContractCallFailed(trx, contractResult, result)
+					break
+				}
+				//合约内部转出的NULS
+				bs.extractContractTransfers(trx, contractResult.Transfers, blockHash, result, ScanTargetFunc)
+				//NRC20和NRC721转账
+				tokenTrans := contractResult.GetTokenTransfers()
 				if tokenTrans == nil || len(tokenTrans) != 1 {
 					bs.wm.Log.Error("Token tokenTrans is nil or len is't 1")
 					break
 				}
+				//合约调用的签名者，transferFrom时代币转出地址不是签名者
+				signer := trx.GetSigner()
 				//提取出账部分记录
 				from, totalSpent := bs.extractTokenTxInput(tokenTrans, blockHash, trx.BlockHeight, result, ScanTargetFunc)
 				//bs.wm.Log.Debug("from:", from, "totalSpent:", totalSpent)
 				//提取入账部分记录
-				to, totalReceived := bs.extractTokenTxOutput(tokenTrans, blockHash, trx.BlockHeight, int64(trx.ConfirmCount), result, ScanTargetFunc)
+				to, totalReceived := bs.extractTokenTxOutput(tokenTrans, signer, blockHash, trx.BlockHeight, int64(trx.ConfirmCount), result, ScanTargetFunc)
 
 				for _, extractData := range result.extractContractData {
 					tokenIn := tokenTrans[0]
+					action := tokenTransferAction(tokenIn, signer)
 					contractId := openwallet.GenContractID(bs.wm.Symbol(), tokenIn.ContractAddress)
 					tx := &openwallet.Transaction{
 
@@ -639,7 +699,7 @@ func (bs *NULSBlockScanner) extractTokenTransaction(trx *Tx, blockHash string, r
 								Name:       tokenIn.Name,
 								Symbol:     bs.wm.Symbol(),
 								Token:      tokenIn.Symbol,
-								Protocol:   "nrc20",
+								Protocol:   tokenIn.Protocol,
 								ContractID: contractId,
 							},
 						},
@@ -649,7 +709,16 @@ func (bs *NULSBlockScanner) extractTokenTransaction(trx *Tx, blockHash string, r
 						Decimal:     8,
 						ConfirmTime: blocktime,
 						Status:      openwallet.TxStatusSuccess,
+						TxType:      WalletTxTypeContract,
+						TxAction:    action,
+					}
+					if action == Nrc20MethodTransferFrom {
+						tx.SetExtParam("spender", signer)
+					}
+					if tokenIn.IsNrc721() {
+						tx.SetExtParam("tokenId", tokenIn.TokenId)
 					}
+					setTransactionRemark(tx, trx.Remark)
 					wxID := openwallet.GenTransactionWxID(tx)
 					tx.WxID = wxID
 					extractData.Transaction = tx
@@ -756,7 +825,7 @@ func (bs *NULSBlockScanner) extractTokenTxInput(nulsTokens []*NulsToken, blockHa
 		//in := vin[i]
 
 		txid := tokenIn.Hash
-		amount, err := decimal.NewFromString(tokenIn.Value)
+		amount, err := tokenIn.GetAmount()
 		if err != nil {
 			bs.wm.Log.Error("nulsTokens value can't be int,err:", err.Error())
 			continue
@@ -783,7 +852,7 @@ func (bs *NULSBlockScanner) extractTokenTxInput(nulsTokens []*NulsToken, blockHa
 					Name:       tokenIn.Name,
 					Symbol:     bs.wm.Symbol(),
 					Token:      tokenIn.Symbol,
-					Protocol:   "nrc20",
+					Protocol:   tokenIn.Protocol,
 					ContractID: contractId,
 				},
 			}
@@ -815,12 +884,13 @@ func (bs *NULSBlockScanner) extractTokenTxInput(nulsTokens []*NulsToken, blockHa
 	return from, totalAmount
 }
 
-//ExtractTxInput 提取交易单输入部分
-func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *ExtractResult, ScanTargetFunc openwallet.BlockScanTargetFunc, txType uint64) ([]string, decimal.Decimal) {
+//ExtractTxInput 提取交易单输出部分，同时返回每个账户监听地址收到的锁定金额
+func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *ExtractResult, ScanTargetFunc openwallet.BlockScanTargetFunc, txType uint64) ([]string, decimal.Decimal, map[string]decimal.Decimal) {
 
 	var (
-		to          = make([]string, 0)
-		totalAmount = decimal.Zero
+		to            = make([]string, 0)
+		totalAmount   = decimal.Zero
+		lockedAmounts = make(map[string]decimal.Decimal)
 	)
 
 	confirmations := trx.ConfirmCount
@@ -836,14 +906,12 @@ func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *E
 		}
 
 
-		if output.LockTime > trx.BlockHeight {
-			bs.wm.Log.Error("nuls lockTime over Than now,height:", trx.BlockHeight)
-			continue
-		}
-
 		amountDecimal, _ := decimal.NewFromString(output.Amount)
 		amount := amountDecimal.Shift(-bs.wm.Decimal()).String()
 
+		//锁定的输出单独统计，-1 表示永久锁定
+		locked := output.LockTime != 0
+
 		addr := output.Address
 		sourceKey, ok := ScanTargetFunc(openwallet.ScanTarget{Address: addr, Symbol: bs.wm.Symbol(), BalanceModelType: openwallet.BalanceModelTypeAddress})
 		if ok {
@@ -873,6 +941,16 @@ func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *E
 			outPut.BlockHash = blockHash
 			outPut.Confirm = int64(confirmations)
 			outPut.TxType = txType
+			if len(trx.Remark) > 0 {
+				outPut.IsMemo = true
+				outPut.Memo = trx.Remark
+				outPut.SetExtParam("memo", trx.Remark)
+			}
+			if locked {
+				outPut.SetExtParam("locked", true)
+				outPut.SetExtParam("lockTime", output.LockTime)
+				lockedAmounts[sourceKey] = lockedAmounts[sourceKey].Add(amountDecimal.Shift(-bs.wm.Decimal()))
+			}
 			//transactions = append(transactions, &transaction)
 
 			ed := result.extractData[sourceKey]
@@ -891,11 +969,11 @@ func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *E
 
 	}
 
-	return to, totalAmount
+	return to, totalAmount, lockedAmounts
 }
 
 //ExtractTxInput 提取交易单输入部分
-func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockHash string, blockHeight int64, confirmation int64, result *ExtractResult, ScanTargetFunc openwallet.BlockScanTargetFunc) ([]string, decimal.Decimal) {
+func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, signer string, blockHash string, blockHeight int64, confirmation int64, result *ExtractResult, ScanTargetFunc openwallet.BlockScanTargetFunc) ([]string, decimal.Decimal) {
 
 	var (
 		to          = make([]string, 0)
@@ -908,7 +986,7 @@ func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockH
 	for i, tokenIn := range nulsTokens {
 
 		txid := tokenIn.Hash
-		amount, err := decimal.NewFromString(tokenIn.Value)
+		amount, err := tokenIn.GetAmount()
 		if err != nil {
 			bs.wm.Log.Error("nulsTokens value can't be int,err:", err.Error())
 			continue
@@ -940,7 +1018,7 @@ func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockH
 					Name:       tokenIn.Name,
 					Symbol:     bs.wm.Symbol(),
 					Token:      tokenIn.Symbol,
-					Protocol:   "nrc20",
+					Protocol:   tokenIn.Protocol,
 				},
 			}
 			outPut.Index = uint64(i)
@@ -953,6 +1031,15 @@ func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockH
 			outPut.BlockHeight = uint64(blockHeight)
 			outPut.BlockHash = blockHash
 			outPut.Confirm = int64(confirmations)
+			outPut.TxType = WalletTxTypeContract
+			action := tokenTransferAction(tokenIn, signer)
+			outPut.SetExtParam("txAction", action)
+			if action == Nrc20MethodTransferFrom {
+				outPut.SetExtParam("spender", signer)
+			}
+			if tokenIn.IsNrc721() {
+				outPut.SetExtParam("tokenId", tokenIn.TokenId)
+			}
 
 			//transactions = append(transactions, &transaction)
 
@@ -975,6 +1062,200 @@ func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockH
 	return to, totalAmount
 }
 
+//setContractCallFailed 合约执行失败时，主币交易标记为失败并只记录手续费的扣除
+//转入合约的NULS会被退回，失败时也不提取合约内部转账避免重复记账，
+//扣除的是输入减输出的预付手续费，未使用的gas由合约返还gas交易(类型19)退回
+func (bs *NULSBlockScanner) setContractCallFailed(trx *Tx, contractResult *ContractResult, result *ExtractResult) {
+
+	var (
+		sender = trx.GetSigner()
+		from   = make([]string, 0)
+	)
+
+	for sourceKey, extractData := range result.extractData {
+		tx := extractData.Transaction
+		if tx == nil {
+			continue
+		}
+
+		//合约调用的输出只有转入合约的NULS，失败后被退回，不记录到账
+		extractData.TxOutputs = make([]*openwallet.TxOutPut, 0)
+		if len(extractData.TxInputs) == 0 {
+			delete(result.extractData, sourceKey)
+			continue
+		}
+
+		//退回的gas单独提取，这里不能按实际消耗扣除，否则退回部分重复入账
+		fees, _ := decimal.NewFromString(tx.Fees)
+		if len(from) == 0 && len(sender) > 0 {
+			from = append(from, sender+":"+fees.String())
+		}
+
+		//合约调用只有一个输入，即调用者支付的手续费
+		for _, input := range extractData.TxInputs {
+			if input.Address == sender {
+				input.Amount = fees.String()
+			}
+		}
+
+		tx.From = from
+		tx.To = make([]string, 0)
+		tx.Fees = fees.StringFixed(bs.wm.Decimal())
+		//合约执行结果中实际消耗的手续费，仅供参考
+		if actualFee, ok := contractResult.ActualFee(); ok {
+			tx.SetExtParam("actualFee", actualFee.Shift(-bs.wm.Decimal()).StringFixed(bs.wm.Decimal()))
+		}
+		tx.Status = openwallet.TxStatusFail
+		tx.Reason = contractResult.ErrorMessage
+		tx.SetExtParam("contractError", contractResult.ErrorMessage)
+	}
+}
+
+//extractContractTransfers 提取合约内部转出的NULS，以合约转账交易的txid记录
+func (bs *NULSBlockScanner) extractContractTransfers(trx *Tx, transfers []*ContractTransfer, blockHash string, result *ExtractResult, ScanTargetFunc openwallet.BlockScanTargetFunc) {
+
+	createAt := time.Now().Unix()
+	for _, transfer := range transfers {
+
+		var (
+			txid          = transfer.TxHash
+			data          = make(map[string]*openwallet.TxExtractData)
+			from          = make([]string, 0)
+			to            = make([]string, 0)
+			totalSpent    = decimal.Zero
+			totalReceived = decimal.Zero
+		)
+
+		//合约转账交易的txid用于生成Sid和WxID，缺失时跳过，避免与合约调用交易冲突
+		if len(txid) == 0 {
+			bs.wm.Log.Errorf("contract transfer of tx: %s has no txHash, skipped", trx.Hash)
+			continue
+		}
+
+		//合约地址转出
+		valueDecimal, err := decimal.NewFromString(transfer.Value)
+		if err != nil {
+			bs.wm.Log.Error("contract transfer value can't be int,err:", err.Error())
+			continue
+		}
+		amount := valueDecimal.Shift(-bs.wm.Decimal())
+		totalSpent = amount
+		from = append(from, transfer.From+":"+amount.String())
+
+		sourceKey, ok := ScanTargetFunc(openwallet.ScanTarget{Address: transfer.From, Symbol: bs.wm.Symbol(), BalanceModelType: openwallet.BalanceModelTypeAddress})
+		if ok {
+			input := openwallet.TxInput{}
+			input.SourceTxID = txid
+			input.TxID = txid
+			input.Address = transfer.From
+			input.Amount = amount.String()
+			input.Coin = openwallet.Coin{
+				Symbol:     bs.wm.Symbol(),
+				IsContract: false,
+			}
+			input.Index = 0
+			input.Sid = openwallet.GenTxInputSID(txid, bs.wm.Symbol(), "", 0)
+			input.CreateAt = createAt
+			input.BlockHeight = uint64(trx.BlockHeight)
+			input.BlockHash = blockHash
+			input.TxType = WalletTxTypeContract
+
+			ed := data[sourceKey]
+			if ed == nil {
+				ed = openwallet.NewBlockExtractData()
+				data[sourceKey] = ed
+			}
+			ed.TxInputs = append(ed.TxInputs, &input)
+		}
+
+		//接收地址
+		for n, output := range transfer.Outputs {
+			outDecimal, err := decimal.NewFromString(output.Value)
+			if err != nil {
+				bs.wm.Log.Error("contract transfer output value can't be int,err:", err.Error())
+				continue
+			}
+			outAmount := outDecimal.Shift(-bs.wm.Decimal())
+			totalReceived = totalReceived.Add(outAmount)
+			to = append(to, output.To+":"+outAmount.String())
+
+			sourceKey, ok := ScanTargetFunc(openwallet.ScanTarget{Address: output.To, Symbol: bs.wm.Symbol(), BalanceModelType: openwallet.BalanceModelTypeAddress})
+			if !ok {
+				continue
+			}
+
+			outPut := openwallet.TxOutPut{}
+			outPut.TxID = txid
+			outPut.Address = output.To
+			outPut.Amount = outAmount.String()
+			outPut.Coin = openwallet.Coin{
+				Symbol:     bs.wm.Symbol(),
+				IsContract: false,
+			}
+			outPut.Index = uint64(n)
+			outPut.Sid = openwallet.GenTxOutPutSID(txid, bs.wm.Symbol(), "", uint64(n))
+			outPut.CreateAt = createAt
+			outPut.BlockHeight = uint64(trx.BlockHeight)
+			outPut.BlockHash = blockHash
+			outPut.Confirm = int64(trx.ConfirmCount)
+			outPut.TxType = WalletTxTypeContract
+			outPut.SetExtParam("contractAddress", transfer.From)
+			outPut.SetExtParam("contractCallTxId", trx.Hash)
+
+			ed := data[sourceKey]
+			if ed == nil {
+				ed = openwallet.NewBlockExtractData()
+				data[sourceKey] = ed
+			}
+			ed.TxOutputs = append(ed.TxOutputs, &outPut)
+		}
+
+		for _, extractData := range data {
+			tx := &openwallet.Transaction{
+				From: from,
+				To:   to,
+				Fees: totalSpent.Sub(totalReceived).StringFixed(8),
+				Coin: openwallet.Coin{
+					Symbol:     bs.wm.Symbol(),
+					IsContract: false,
+				},
+				BlockHash:   blockHash,
+				BlockHeight: uint64(trx.BlockHeight),
+				TxID:        txid,
+				Decimal:     8,
+				ConfirmTime: trx.GetTime(),
+				Status:      openwallet.TxStatusSuccess,
+				TxType:      WalletTxTypeContract,
+			}
+			tx.SetExtParam("contractCallTxId", trx.Hash)
+			tx.WxID = openwallet.GenTransactionWxID(tx)
+			extractData.Transaction = tx
+		}
+
+		if len(data) > 0 {
+			result.extractTransferData = append(result.extractTransferData, data)
+		}
+	}
+}
+
+//tokenTransferAction 代币转出地址不是交易签名者时为transferFrom，否则为transfer
+func tokenTransferAction(token *NulsToken, signer string) string {
+	if len(signer) > 0 && token.From != signer {
+		return Nrc20MethodTransferFrom
+	}
+	return "transfer"
+}
+
+//setTransactionRemark 记录交易备注，用于按备注匹配充值
+func setTransactionRemark(tx *openwallet.Transaction, remark string) {
+	if len(remark) == 0 {
+		return
+	}
+	tx.IsMemo = true
+	tx.Memo = remark
+	tx.SetExtParam("memo", remark)
+}
+
 //newExtractDataNotify 发送通知
 func (bs *NULSBlockScanner) newExtractDataNotify(height uint64, extractData map[string]*openwallet.TxExtractData) error {
 
@@ -1070,6 +1351,11 @@ func (bs *NULSBlockScanner) ExtractTransactionData(txid string, scanTargetFunc o
 		txs = append(txs, data)
 		extData[key] = txs
 	}
+	for _, transferData := range result.extractTransferData {
+		for key, data := range transferData {
+			extData[key] = append(extData[key], data)
+		}
+	}
 	return extData, nil
 }
 
@@ -1293,7 +1579,7 @@ func (wm *WalletManager) getBalanceCalUnspent(address ...string) ([]*openwallet.
 
 		var obj *openwallet.Balance
 
-		nulsBalance, err := wm.Api.GetAddressBalance(a, 1)
+		nulsBalance, err := wm.Api.GetAddressBalance(a, MainAssetChainId, MainAssetId)
 		if err != nil {
 			return nil, errors.New("cant get balances:" + err.Error())
 		}
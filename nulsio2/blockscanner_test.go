@@ -0,0 +1,442 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+//newTestScanner 测试用的扫描器，不连接节点
+func newTestScanner() *NULSBlockScanner {
+	return NewWalletManager().Blockscanner
+}
+
+//scanTargets 按地址返回sourceKey的ScanTargetFunc
+func scanTargets(targets map[string]string) openwallet.BlockScanTargetFunc {
+	return func(target openwallet.ScanTarget) (string, bool) {
+		sourceKey, ok := targets[target.Address]
+		return sourceKey, ok
+	}
+}
+
+//nulsInput 主链NULS的输入
+func nulsInput(address, amount string) *Input {
+	return &Input{Address: address, AssetsChainId: 1, AssetsId: 1, Amount: amount}
+}
+
+//nulsOutput 主链NULS的输出
+func nulsOutput(address, amount string, lockTime int64) *Output {
+	return &Output{Address: address, AssetsChainId: 1, AssetsId: 1, Amount: amount, LockTime: lockTime}
+}
+
+func TestExtractTransaction_Transfer(t *testing.T) {
+	bs := newTestScanner()
+	tx := &Tx{
+		Hash:        "tx1",
+		BlockHeight: 100,
+		Time:        "2020-01-01 00:00:00.000",
+		Type:        TxTypeTransfer,
+		Remark:      "memo",
+		Inputs:      []*Input{nulsInput("A", "150100000")},
+		Outputs: []*Output{
+			nulsOutput("B", "100000000", 0),
+			nulsOutput("B", "30000000", -1),
+			nulsOutput("C", "20000000", 1600000000),
+			//非NULS资产不提取
+			{Address: "B", AssetsChainId: 2, AssetsId: 1, Amount: "1"},
+		},
+	}
+
+	result := bs.ExtractTransaction(100, "block100", tx, scanTargets(map[string]string{"A": "a", "B": "b"}))
+	if !result.Success {
+		t.Fatalf("ExtractTransaction failed")
+	}
+	if len(result.extractData) != 2 || len(result.extractContractData) != 0 {
+		t.Fatalf("unexpected extract data: %d, %d", len(result.extractData), len(result.extractContractData))
+	}
+
+	sender := result.extractData["a"]
+	if len(sender.TxInputs) != 1 || sender.TxInputs[0].Amount != "1.501" || len(sender.TxOutputs) != 0 {
+		t.Errorf("unexpected sender data: %+v", sender)
+	}
+	if sender.Transaction.Fees != "0.00100000" || sender.Transaction.TxType != WalletTxTypeTransfer || sender.Transaction.TxAction != "transfer" {
+		t.Errorf("unexpected sender tx: %+v", sender.Transaction)
+	}
+	if sender.Transaction.GetExtParam().Get("lockedAmount").Exists() {
+		t.Errorf("sender should not have locked amount: %s", sender.Transaction.ExtParam)
+	}
+	if sender.Transaction.Memo != "memo" || sender.Transaction.BlockHeight != 100 || sender.Transaction.BlockHash != "block100" {
+		t.Errorf("unexpected sender tx: %+v", sender.Transaction)
+	}
+
+	//只统计接收账户监听地址的锁定金额，C的锁定输出不计入
+	receiver := result.extractData["b"]
+	if len(receiver.TxInputs) != 0 || len(receiver.TxOutputs) != 2 {
+		t.Fatalf("unexpected receiver data: %+v", receiver)
+	}
+	if locked := receiver.Transaction.GetExtParam().Get("lockedAmount").String(); locked != "0.30000000" {
+		t.Errorf("unexpected locked amount: %s", locked)
+	}
+	if receiver.TxOutputs[1].Index != 1 || !strings.Contains(receiver.TxOutputs[1].ExtParam, `"locked":true`) {
+		t.Errorf("unexpected locked output: %+v", receiver.TxOutputs[1])
+	}
+	if receiver.Transaction.WxID != openwallet.GenTransactionWxID(receiver.Transaction) {
+		t.Errorf("unexpected wxID: %s", receiver.Transaction.WxID)
+	}
+	if len(receiver.Transaction.To) != 3 {
+		t.Errorf("unexpected to: %v", receiver.Transaction.To)
+	}
+}
+
+func TestExtractTransaction_TxTypes(t *testing.T) {
+	cases := []struct {
+		txType  int32
+		extract bool
+		wxType  uint64
+		action  string
+	}{
+		{TxTypeCoinBase, true, WalletTxTypeCustomize + 1, "coinBase"},
+		{TxTypeTransfer, true, WalletTxTypeTransfer, "transfer"},
+		{TxTypeDeposit, true, WalletTxTypeCustomize + 5, "deposit"},
+		{TxTypeCrossChain, true, WalletTxTypeTransfer, "crossChain"},
+		{TxTypeCreateContract, true, WalletTxTypeContract, "createContract"},
+		{TxTypeContractReturnGas, true, WalletTxTypeContract, "contractReturnGas"},
+		{TxTypeVerifierInit, true, WalletTxTypeCustomize + 25, "verifierInit"},
+		//合约内部转账从合约调用的执行结果中提取
+		{TxTypeContractTransfer, false, 0, ""},
+		//未知类型
+		{99, false, 0, ""},
+	}
+
+	bs := newTestScanner()
+	for _, c := range cases {
+		tx := &Tx{
+			Hash:        fmt.Sprintf("tx%d", c.txType),
+			BlockHeight: 100,
+			Type:        c.txType,
+			Outputs:     []*Output{nulsOutput("B", "100000000", 0)},
+		}
+
+		result := bs.ExtractTransaction(100, "block100", tx, scanTargets(map[string]string{"B": "b"}))
+		if !result.Success {
+			t.Errorf("type %d: ExtractTransaction failed", c.txType)
+			continue
+		}
+		if !c.extract {
+			if len(result.extractData) != 0 {
+				t.Errorf("type %d: should not be extracted", c.txType)
+			}
+			continue
+		}
+
+		data := result.extractData["b"]
+		if data == nil || data.Transaction == nil {
+			t.Errorf("type %d: not extracted", c.txType)
+			continue
+		}
+		if data.Transaction.TxType != c.wxType || data.Transaction.TxAction != c.action || data.TxOutputs[0].TxType != c.wxType {
+			t.Errorf("type %d: unexpected tx type: %d, %s", c.txType, data.Transaction.TxType, data.Transaction.TxAction)
+		}
+	}
+}
+
+func TestSetContractCallFailed(t *testing.T) {
+	cases := []struct {
+		name      string
+		result    *ContractResult
+		actualFee string
+	}{
+		{"actual fee", &ContractResult{TxSizeFee: "100000", ActualContractFee: "250000"}, "0.00350000"},
+		//退回的gas由类型19的交易提取，扣除的仍是预付的手续费
+		{"total fee", &ContractResult{TotalFee: "500000", RefundFee: "200000"}, "0.00300000"},
+		{"no fee", &ContractResult{}, ""},
+	}
+
+	bs := newTestScanner()
+	for _, c := range cases {
+		tx := &Tx{
+			Hash:        "call",
+			BlockHeight: 100,
+			Type:        TxTypeCallContract,
+			Inputs:      []*Input{nulsInput("A", "1000000000")},
+			Outputs:     []*Output{nulsOutput("C", "900000000", 0)},
+		}
+		c.result.Success = false
+		c.result.ErrorMessage = "contract revert"
+
+		result := ExtractResult{extractData: make(map[string]*openwallet.TxExtractData)}
+		bs.extractTransaction(tx, "block100", &result, scanTargets(map[string]string{"A": "a", "C": "c"}))
+		bs.setContractCallFailed(tx, c.result, &result)
+
+		//转入合约的NULS已退回，合约地址不记录到账
+		if _, ok := result.extractData["c"]; ok || len(result.extractData) != 1 {
+			t.Errorf("%s: contract receiver should be removed", c.name)
+			continue
+		}
+		data := result.extractData["a"]
+		if data.Transaction.Status != openwallet.TxStatusFail || data.Transaction.Reason != "contract revert" {
+			t.Errorf("%s: unexpected tx status: %+v", c.name, data.Transaction)
+		}
+		//按输入减输出扣除
+		if data.Transaction.Fees != "1.00000000" || len(data.TxOutputs) != 0 || len(data.Transaction.To) != 0 {
+			t.Errorf("%s: unexpected fees: %s, outputs: %d", c.name, data.Transaction.Fees, len(data.TxOutputs))
+		}
+		if data.TxInputs[0].Amount != "1" {
+			t.Errorf("%s: unexpected input amount: %s", c.name, data.TxInputs[0].Amount)
+		}
+		if actualFee := data.Transaction.GetExtParam().Get("actualFee").String(); actualFee != c.actualFee {
+			t.Errorf("%s: unexpected actual fee: %s", c.name, actualFee)
+		}
+	}
+}
+
+func TestSetContractCallFailed_ReturnGas(t *testing.T) {
+	bs := newTestScanner()
+	targets := scanTargets(map[string]string{"A": "a"})
+
+	//转入合约1 NULS，预付手续费0.005，执行失败后退回0.002的gas
+	call := &Tx{
+		Hash:        "call",
+		BlockHeight: 100,
+		Type:        TxTypeCallContract,
+		Inputs:      []*Input{nulsInput("A", "100500000")},
+		Outputs:     []*Output{nulsOutput("C", "100000000", 0)},
+	}
+	returnGas := &Tx{
+		Hash:        "returnGas",
+		BlockHeight: 100,
+		Type:        TxTypeContractReturnGas,
+		Outputs:     []*Output{nulsOutput("A", "200000", 0)},
+	}
+
+	callResult := ExtractResult{extractData: make(map[string]*openwallet.TxExtractData)}
+	bs.extractTransaction(call, "block100", &callResult, targets)
+	bs.setContractCallFailed(call, &ContractResult{ErrorMessage: "contract revert", TotalFee: "500000", RefundFee: "200000"}, &callResult)
+
+	returnResult := ExtractResult{extractData: make(map[string]*openwallet.TxExtractData)}
+	bs.extractTransaction(returnGas, "block100", &returnResult, targets)
+
+	//调用者的余额变化等于实际消耗的手续费
+	balance := decimal.Zero
+	for _, result := range []ExtractResult{callResult, returnResult} {
+		data := result.extractData["a"]
+		if data == nil {
+			t.Fatalf("tx of sender not extracted")
+		}
+		for _, input := range data.TxInputs {
+			amount, _ := decimal.NewFromString(input.Amount)
+			balance = balance.Sub(amount)
+		}
+		for _, output := range data.TxOutputs {
+			amount, _ := decimal.NewFromString(output.Amount)
+			balance = balance.Add(amount)
+		}
+	}
+	if balance.String() != "-0.003" {
+		t.Errorf("unexpected balance change of sender: %s", balance.String())
+	}
+}
+
+func TestExtractContractTransfers(t *testing.T) {
+	bs := newTestScanner()
+	tx := &Tx{Hash: "call", BlockHeight: 100, Type: TxTypeCallContract}
+	transfers := []*ContractTransfer{
+		{
+			TxHash:  "transfer1",
+			From:    "C",
+			Value:   "300000000",
+			Outputs: []*ContractTransferOutput{{To: "B", Value: "200000000"}, {To: "D", Value: "100000000"}},
+		},
+		//缺少txHash的转账跳过
+		{From: "C", Value: "100000000", Outputs: []*ContractTransferOutput{{To: "B", Value: "100000000"}}},
+		//没有监听地址
+		{TxHash: "transfer3", From: "E", Value: "100000000", Outputs: []*ContractTransferOutput{{To: "D", Value: "100000000"}}},
+	}
+
+	result := ExtractResult{extractData: make(map[string]*openwallet.TxExtractData)}
+	bs.extractContractTransfers(tx, transfers, "block100", &result, scanTargets(map[string]string{"B": "b", "C": "c"}))
+
+	if len(result.extractTransferData) != 1 {
+		t.Fatalf("unexpected transfer data count: %d", len(result.extractTransferData))
+	}
+	data := result.extractTransferData[0]
+
+	contract := data["c"]
+	if contract == nil || len(contract.TxInputs) != 1 || contract.TxInputs[0].Amount != "3" || contract.TxInputs[0].TxID != "transfer1" {
+		t.Fatalf("unexpected contract data: %+v", contract)
+	}
+
+	receiver := data["b"]
+	if receiver == nil || len(receiver.TxOutputs) != 1 || receiver.TxOutputs[0].Amount != "2" || receiver.TxOutputs[0].Index != 0 {
+		t.Fatalf("unexpected receiver data: %+v", receiver)
+	}
+	if callTxId := receiver.TxOutputs[0].ExtParam; !strings.Contains(callTxId, `"contractCallTxId":"call"`) {
+		t.Errorf("unexpected output ext param: %s", callTxId)
+	}
+
+	//以合约转账交易的txid生成WxID，不与合约调用交易冲突
+	tx1 := receiver.Transaction
+	if tx1.TxID != "transfer1" || tx1.TxType != WalletTxTypeContract || tx1.Fees != "0.00000000" {
+		t.Errorf("unexpected transfer tx: %+v", tx1)
+	}
+	if tx1.GetExtParam().Get("contractCallTxId").String() != "call" || tx1.WxID != openwallet.GenTransactionWxID(tx1) {
+		t.Errorf("unexpected transfer tx: %+v", tx1)
+	}
+	if len(tx1.From) != 1 || tx1.From[0] != "C:3" || len(tx1.To) != 2 {
+		t.Errorf("unexpected transfer from: %v, to: %v", tx1.From, tx1.To)
+	}
+}
+
+func TestExtractMemPoolTransaction(t *testing.T) {
+	bs := newTestScanner()
+	tx := &Tx{
+		Hash:         "pending",
+		BlockHeight:  100,
+		ConfirmCount: 3,
+		Time:         "2020-01-01 00:00:00.000",
+		Type:         TxTypeTransfer,
+		Inputs:       []*Input{nulsInput("A", "100100000")},
+		Outputs:      []*Output{nulsOutput("B", "100000000", 0)},
+	}
+
+	result := bs.extractMemPoolTransaction(tx, scanTargets(map[string]string{"B": "b"}))
+	if !result.Success || result.TxID != "pending" {
+		t.Fatalf("extractMemPoolTransaction failed")
+	}
+	data := result.extractData["b"]
+	if data == nil || data.Transaction == nil {
+		t.Fatalf("mempool tx not extracted")
+	}
+	if data.Transaction.BlockHeight != 0 || data.TxOutputs[0].BlockHeight != 0 || data.TxOutputs[0].Confirm != 0 {
+		t.Errorf("mempool tx should not have block height: %+v", data.Transaction)
+	}
+	if data.Transaction.Status != openwallet.TxStatusSuccess || !data.Transaction.GetExtParam().Get("unconfirmed").Bool() {
+		t.Errorf("unexpected mempool tx status: %s, %s", data.Transaction.Status, data.Transaction.ExtParam)
+	}
+	if data.Transaction.ConfirmTime != 0 || data.Transaction.SubmitTime != tx.GetTime() {
+		t.Errorf("unexpected mempool tx time: %+v", data.Transaction)
+	}
+}
+
+func TestMemPoolCache(t *testing.T) {
+	bs := newTestScanner()
+	bs.IsScanMemPool = true
+	cache := bs.memPool
+
+	if !cache.add("a") || cache.add("a") || !cache.add("b") {
+		t.Fatalf("unexpected add result")
+	}
+
+	//区块扫描到交易后记录为已上链
+	bs.ExtractTransaction(100, "block100", &Tx{Hash: "a", Type: TxTypeTransfer}, scanTargets(nil))
+	if confirmed, ok := cache.txs["a"]; !ok || !confirmed {
+		t.Errorf("tx should be confirmed by block scanning")
+	}
+	if cache.add("a") {
+		t.Errorf("confirmed tx should not be notified again")
+	}
+
+	//不在交易池中的记录被移除
+	cache.prune(map[string]bool{"a": true})
+	if _, ok := cache.txs["b"]; ok || len(cache.txs) != 1 {
+		t.Errorf("unexpected cache after prune: %v", cache.txs)
+	}
+	if !cache.add("b") {
+		t.Errorf("pruned tx should be added again")
+	}
+}
+
+//testBlockchainDAI 测试用的本地区块记录
+type testBlockchainDAI struct {
+	openwallet.BlockchainDAIBase
+	blocks map[uint64]string //height -> hash
+}
+
+func (dai *testBlockchainDAI) GetLocalBlockHeadByHeight(height uint64, symbol string) (*openwallet.BlockHeader, error) {
+	hash, ok := dai.blocks[height]
+	if !ok {
+		return nil, fmt.Errorf("block of height: %d not found", height)
+	}
+	return &openwallet.BlockHeader{Height: height, Hash: hash, Symbol: symbol}, nil
+}
+
+//newBlockServer 按高度返回区块，高度大于forkHeight的区块hash为新链
+func newBlockServer(forkHeight uint64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var height uint64
+		fmt.Sscanf(r.URL.Path, "/api/block/height/%d", &height)
+		hash := fmt.Sprintf("h%d", height)
+		if height > forkHeight {
+			hash = fmt.Sprintf("new%d", height)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success":true,"data":{"header":{"hash":"%s","height":%d},"txs":[]}}`, hash, height)
+	}))
+}
+
+func TestFindForkAncestor(t *testing.T) {
+	server := newBlockServer(97)
+	defer server.Close()
+
+	cases := []struct {
+		name     string
+		local    map[uint64]string
+		maxDepth uint64
+		ancestor string
+		forks    []string
+		fail     bool
+	}{
+		{"ancestor", map[uint64]string{96: "h96", 97: "h97", 98: "old98", 99: "old99", 100: "old100"}, 0, "h97", []string{"old100", "old99", "old98"}, false},
+		//本地没有记录的高度以节点区块作为共同祖先
+		{"missing local", map[uint64]string{99: "old99", 100: "old100"}, 0, "new98", []string{"old100", "old99"}, false},
+		{"max depth", map[uint64]string{97: "h97", 98: "old98", 99: "old99", 100: "old100"}, 2, "", nil, true},
+	}
+
+	for _, c := range cases {
+		bs := newTestScanner()
+		bs.wm.Api = newTestClient(server.URL)
+		bs.wm.Config.MaxReorgDepth = c.maxDepth
+		bs.SetBlockchainDAI(&testBlockchainDAI{blocks: c.local})
+
+		ancestor, forkBlocks, err := bs.findForkAncestor(100)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: fork deeper than max reorg depth should fail", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: findForkAncestor failed, unexpected error: %v", c.name, err)
+			continue
+		}
+		if ancestor.Hash != c.ancestor {
+			t.Errorf("%s: unexpected ancestor: %s", c.name, ancestor.Hash)
+		}
+		forks := make([]string, 0, len(forkBlocks))
+		for _, b := range forkBlocks {
+			forks = append(forks, b.Hash)
+		}
+		if fmt.Sprint(forks) != fmt.Sprint(c.forks) {
+			t.Errorf("%s: unexpected fork blocks: %v", c.name, forks)
+		}
+	}
+}
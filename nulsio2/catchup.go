@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"sync"
+)
+
+//prefetchedBlock 预取的区块
+type prefetchedBlock struct {
+	hash  string
+	block *NusBlock
+}
+
+//catchUpWindow 计算并发预取的区块数量，未开启或接近最新高度时返回0
+func (bs *NULSBlockScanner) catchUpWindow(currentHeight, maxHeight uint64) int {
+
+	concurrency := bs.wm.Config.CatchUpConcurrency
+	window := bs.wm.Config.CatchUpWindow
+	if concurrency <= 1 || window <= 1 || maxHeight <= currentHeight {
+		return 0
+	}
+
+	behind := maxHeight - currentHeight
+	if behind <= bs.wm.Config.CatchUpTipDistance {
+		return 0
+	}
+
+	//预取不超过距离最新高度的范围，保留末尾的区块逐个获取
+	behind -= bs.wm.Config.CatchUpTipDistance
+	if uint64(window) > behind {
+		window = int(behind)
+	}
+
+	return window
+}
+
+//prefetchBlocks 并发获取从height开始的count个区块，获取失败的高度不在结果中，由顺序扫描重新获取
+func (bs *NULSBlockScanner) prefetchBlocks(height uint64, count int) map[uint64]*prefetchedBlock {
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		blocks    = make(map[uint64]*prefetchedBlock, count)
+		semaphore = make(chan struct{}, bs.wm.Config.CatchUpConcurrency)
+	)
+
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(h uint64) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			hashResult, err := bs.wm.GetBlockHash(h)
+			if err != nil {
+				bs.wm.Log.Std.Info("block scanner prefetch block hash on height: %d failed; unexpected error: %v", h, err)
+				return
+			}
+
+			block, err := bs.wm.GetBlock(hashResult.Hash)
+			if err != nil {
+				bs.wm.Log.Std.Info("block scanner prefetch block data on height: %d failed; unexpected error: %v", h, err)
+				return
+			}
+
+			mu.Lock()
+			blocks[h] = &prefetchedBlock{hash: hashResult.Hash, block: block}
+			mu.Unlock()
+		}(height + uint64(i))
+	}
+
+	wg.Wait()
+
+	return blocks
+}
@@ -27,11 +27,60 @@ const (
 	Symbol    = "NULS2"
 	CurveType = owcrypt.ECC_CURVE_SECP256K1
 
+	//合约调用的最大gasLimit和最低gas单价
+	MaxContractGasLimit = uint64(10000000)
+	MinContractGasPrice = uint64(25)
+
 	//默认配置内容
 	defaultConfig = `
 
 # RPC api url
 serverAPI = ""
+# api backend, "rest" is the explorer api, "jsonrpc" is the JSON-RPC api of NULS 2.0 public-service
+apiBackend = "rest"
+# chain id of the JSON-RPC api
+chainId = 1
+# several api urls with priorities for failover, e.g. "http://a:18003|0,http://b:18003|1", overrides serverAPI
+serverAPIs = ""
+# endpoints behind the highest endpoint more than this number of blocks are taken out of rotation
+maxHeightLag = 10
+# interval of endpoints health check, in seconds
+healthCheckInterval = 60
+# broadcast transactions to all healthy endpoints
+broadcastAll = false
+# timeout of each api request, in seconds
+requestTimeout = 30
+# retry times of failed GET requests
+requestRetries = 3
+# min and max wait time before retrying, in milliseconds
+retryWaitMin = 500
+retryWaitMax = 5000
+# combine several addresses as inputs when one address balance is not enough
+multiInputs = false
+# max inputs of one transaction
+maxTxInputs = 50
+# fee rate per KB
+feeRate = "0.001"
+# minimum fees of one transaction
+fixFees = "0.001"
+# safety margin multiplied to the estimated gas of contract call
+gasSafetyMargin = 1.2
+# scan unconfirmed transactions of mempool, only supported by the "rest" api backend
+scanMemPool = false
+# concurrent requests to prefetch blocks when catching up, 1 means sequential
+catchUpConcurrency = 10
+# number of blocks prefetched at a time when catching up
+catchUpWindow = 50
+# scan sequentially when the distance to the newest block is not greater than this
+catchUpTipDistance = 20
+# max blocks to roll back when the chain forks, 0 means no limit
+maxReorgDepth = 100
+# validate signed transactions on node, set false on offline signing machines
+validateOnNode = true
+# confirmations required before a transaction is final
+confirmations = 1
+# confirmations of each asset, e.g. "NULS2:6,tNULSeBaN...:12", asset is symbol or contract address
+assetConfirmations = ""
 
 `
 )
@@ -49,6 +98,10 @@ type WalletConfig struct {
 	dbPath string
 	//钱包服务API
 	ServerAPI string
+	//多个钱包服务API及优先级
+	ServerAPIs string
+	//钱包服务API类型，rest 或 jsonrpc
+	APIBackend string
 	//默认配置内容
 	DefaultConfig string
 	//曲线类型
@@ -58,12 +111,36 @@ type WalletConfig struct {
 
 	ChainId     string //链ID
 	MaxTxInputs int
+	//单个地址余额不足时，是否合并多个地址作为输入
+	MultiInputs bool
 
 	DataDir string
 
+	//最低手续费
 	FixFees string
+	//每KB手续费率
+	FeeRate string
 
+	//已由手续费引擎按gas和字节数计算，保留配置兼容
 	TokenFees string
+	//合约调用预估gas的安全系数
+	GasSafetyMargin float64
+	//是否扫描交易池的未确认交易
+	ScanMemPool bool
+	//追赶区块时并发预取的请求数，1为逐个扫描
+	CatchUpConcurrency int
+	//追赶区块时每次预取的区块数
+	CatchUpWindow int
+	//距离最新高度不超过该值时逐个扫描
+	CatchUpTipDistance uint64
+	//分叉时最多回滚的区块数，0为不限制
+	MaxReorgDepth uint64
+	//签名后是否在节点验证交易单，离线签名时关闭
+	ValidateOnNode bool
+	//交易到账需要的确认数
+	Confirmations uint64
+	//各资产到账需要的确认数，未配置的资产使用Confirmations
+	AssetConfirmations map[string]uint64
 }
 
 func NewConfig(symbol string) *WalletConfig {
@@ -75,7 +152,16 @@ func NewConfig(symbol string) *WalletConfig {
 	c.CurveType = CurveType
 	c.MaxTxInputs = 50
 	c.FixFees = "0.001"
+	c.FeeRate = "0.001"
 	c.TokenFees = "0.015"
+	c.GasSafetyMargin = 1.2
+	c.CatchUpConcurrency = 10
+	c.CatchUpWindow = 50
+	c.CatchUpTipDistance = 20
+	c.MaxReorgDepth = 100
+	c.ValidateOnNode = true
+	c.Confirmations = 1
+	c.AssetConfirmations = make(map[string]uint64)
 	//区块链数据
 	//blockchainDir = filepath.Join("data", strings.ToLower(Symbol), "blockchain")
 	//配置文件路径
@@ -88,6 +174,8 @@ func NewConfig(symbol string) *WalletConfig {
 	c.dbPath = filepath.Join("data", strings.ToLower(c.Symbol), "db")
 	//钱包服务API
 	c.ServerAPI = ""
+	c.APIBackend = APIBackendREST
+	c.ChainId = "1"
 
 	//创建目录
 	file.MkdirAll(c.dbPath)
@@ -0,0 +1,262 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//ParseAssetConfirmations 解析各资产的确认数配置，格式为 "资产:确认数,资产:确认数"
+//资产为主链币的symbol或NRC20/NRC721的合约地址
+func ParseAssetConfirmations(s string) (map[string]uint64, error) {
+	confirmations := make(map[string]uint64)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		i := strings.LastIndex(item, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid asset confirmations: %s", item)
+		}
+
+		n, err := strconv.ParseUint(strings.TrimSpace(item[i+1:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset confirmations: %s", item)
+		}
+
+		confirmations[strings.TrimSpace(item[:i])] = n
+	}
+	return confirmations, nil
+}
+
+//GetConfirmations 获取币种到账需要的确认数
+func (wc *WalletConfig) GetConfirmations(coin openwallet.Coin) uint64 {
+	key := coin.Symbol
+	if coin.IsContract {
+		key = coin.Contract.Address
+	}
+
+	if n, ok := wc.AssetConfirmations[key]; ok {
+		return n
+	}
+
+	return wc.Confirmations
+}
+
+//MaxConfirmations 获取所有资产中最大的确认数
+func (wc *WalletConfig) MaxConfirmations() uint64 {
+	max := wc.Confirmations
+	for _, n := range wc.AssetConfirmations {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+//pendingConfirmation 未达到确认数的交易
+type pendingConfirmation struct {
+	sourceKey     string
+	data          *openwallet.TxExtractData
+	height        uint64
+	confirmations uint64
+}
+
+//confirmationTracker 跟踪已通知交易的确认数，达到确认数后再次通知
+type confirmationTracker struct {
+	mu        sync.Mutex
+	pending   map[string]*pendingConfirmation //sourceKey + wxID -> 交易
+	finalized map[string]uint64               //wxID -> 达到确认数时的区块高度
+	restored  bool                            //是否已恢复重启前的待确认交易
+}
+
+func newConfirmationTracker() *confirmationTracker {
+	return &confirmationTracker{
+		pending:   make(map[string]*pendingConfirmation),
+		finalized: make(map[string]uint64),
+	}
+}
+
+//setConfirmed 设置交易及其输出的确认数、需要的确认数和是否已确认
+func setConfirmed(data *openwallet.TxExtractData, confirm int64, confirmations uint64, confirmed bool) {
+	data.Transaction.Confirm = confirm
+	data.Transaction.SetExtParam("confirmed", confirmed)
+	data.Transaction.SetExtParam("confirmations", confirmations)
+	for _, output := range data.TxOutputs {
+		output.Confirm = confirm
+		output.SetExtParam("confirmed", confirmed)
+		output.SetExtParam("confirmations", confirmations)
+	}
+}
+
+//trackConfirmations 在通知前记录区块中需要多个确认的交易，scannedHeight为已扫描的区块高度
+//未达到确认数的交易标记confirmed为false，已通知过最终确认的交易从extractData中移除，不再重复通知
+func (bs *NULSBlockScanner) trackConfirmations(height, scannedHeight uint64, extractData map[string]*openwallet.TxExtractData) {
+
+	if scannedHeight < height {
+		scannedHeight = height
+	}
+	confirm := scannedHeight - height + 1
+
+	//同一交易的各账户WxID相同，本次达到确认数的交易在处理完后再记录
+	finalized := make(map[string]uint64)
+
+	bs.confirmTracker.mu.Lock()
+	defer bs.confirmTracker.mu.Unlock()
+
+	for sourceKey, data := range extractData {
+		if data == nil || data.Transaction == nil {
+			continue
+		}
+
+		confirmations := bs.wm.Config.GetConfirmations(data.Transaction.Coin)
+		if confirmations <= 1 {
+			continue
+		}
+
+		wxID := data.Transaction.WxID
+		if _, ok := bs.confirmTracker.finalized[wxID]; ok {
+			delete(extractData, sourceKey)
+			continue
+		}
+
+		//重扫较早的区块时交易已达到确认数
+		if confirm >= confirmations {
+			setConfirmed(data, int64(confirm), confirmations, true)
+			finalized[wxID] = scannedHeight
+			continue
+		}
+
+		setConfirmed(data, int64(confirm), confirmations, false)
+		bs.confirmTracker.pending[sourceKey+"_"+wxID] = &pendingConfirmation{
+			sourceKey:     sourceKey,
+			data:          data,
+			height:        height,
+			confirmations: confirmations,
+		}
+	}
+
+	for wxID, h := range finalized {
+		bs.confirmTracker.finalized[wxID] = h
+	}
+}
+
+//notifyConfirmedTxs 当前高度下达到确认数的交易再次通知观测者，交易扩展参数confirmed为true
+func (bs *NULSBlockScanner) notifyConfirmedTxs(currentHeight uint64) {
+
+	confirmed := make([]*pendingConfirmation, 0)
+
+	bs.confirmTracker.mu.Lock()
+	for key, p := range bs.confirmTracker.pending {
+		if currentHeight < p.height || currentHeight-p.height+1 < p.confirmations {
+			continue
+		}
+		confirmed = append(confirmed, p)
+		delete(bs.confirmTracker.pending, key)
+		bs.confirmTracker.finalized[p.data.Transaction.WxID] = currentHeight
+	}
+
+	//超出重扫范围的交易不会再被提取，无需记录
+	for wxID, h := range bs.confirmTracker.finalized {
+		if h+bs.RescanLastBlockCount < currentHeight {
+			delete(bs.confirmTracker.finalized, wxID)
+		}
+	}
+	bs.confirmTracker.mu.Unlock()
+
+	for _, p := range confirmed {
+		setConfirmed(p.data, int64(currentHeight-p.height+1), p.confirmations, true)
+
+		for o := range bs.Observers {
+			if err := o.BlockExtractDataNotify(p.sourceKey, p.data); err != nil {
+				bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
+			}
+		}
+	}
+}
+
+//dropConfirmations 分叉时移除高于共同祖先区块的待确认和已确认记录
+func (bs *NULSBlockScanner) dropConfirmations(ancestorHeight uint64) {
+
+	bs.confirmTracker.mu.Lock()
+	defer bs.confirmTracker.mu.Unlock()
+
+	for key, p := range bs.confirmTracker.pending {
+		if p.height > ancestorHeight {
+			delete(bs.confirmTracker.pending, key)
+		}
+	}
+
+	for wxID, h := range bs.confirmTracker.finalized {
+		if h > ancestorHeight {
+			delete(bs.confirmTracker.finalized, wxID)
+		}
+	}
+}
+
+//restoreConfirmations 重启后重扫本地最近的区块，恢复未达到确认数的交易，只在首次扫描时执行且不通知观测者
+func (bs *NULSBlockScanner) restoreConfirmations(localHeight uint64) {
+
+	bs.confirmTracker.mu.Lock()
+	restored := bs.confirmTracker.restored
+	bs.confirmTracker.restored = true
+	bs.confirmTracker.mu.Unlock()
+
+	confirmations := bs.wm.Config.MaxConfirmations()
+	if restored || localHeight == 0 || confirmations <= 1 {
+		return
+	}
+
+	//高度低于start的交易在localHeight已达到确认数
+	start := uint64(1)
+	if localHeight+2 > confirmations {
+		start = localHeight + 2 - confirmations
+	}
+
+	for height := start; height <= localHeight; height++ {
+
+		hashResult, err := bs.wm.GetBlockHash(height)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not restore confirmations of height: %d; unexpected error: %v", height, err)
+			continue
+		}
+
+		block, err := bs.wm.GetBlock(hashResult.Hash)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not restore confirmations of height: %d; unexpected error: %v", height, err)
+			continue
+		}
+
+		for _, tx := range block.TxList {
+			result := bs.ExtractTransaction(height, hashResult.Hash, tx, bs.ScanTargetFunc)
+			if !result.Success {
+				continue
+			}
+			bs.trackConfirmations(height, localHeight, result.extractData)
+			bs.trackConfirmations(height, localHeight, result.extractContractData)
+			for _, transferData := range result.extractTransferData {
+				bs.trackConfirmations(height, localHeight, transferData)
+			}
+		}
+	}
+}
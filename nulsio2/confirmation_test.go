@@ -0,0 +1,154 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//testObserver 记录收到的交易通知
+type testObserver struct {
+	notified []*openwallet.TxExtractData
+}
+
+func (o *testObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.notified = append(o.notified, data)
+	return nil
+}
+
+func (o *testObserver) BlockExtractSmartContractDataNotify(sourceKey string, data *openwallet.SmartContractReceipt) error {
+	return nil
+}
+
+//extractTransfer 提取区块中A转给B的交易，两个账户的交易WxID相同
+func extractTransfer(bs *NULSBlockScanner, txid string, height uint64) map[string]*openwallet.TxExtractData {
+	tx := &Tx{
+		Hash:        txid,
+		BlockHeight: int64(height),
+		Type:        TxTypeTransfer,
+		Inputs:      []*Input{nulsInput("A", "100100000")},
+		Outputs:     []*Output{nulsOutput("B", "100000000", 0)},
+	}
+	result := bs.ExtractTransaction(height, "block", tx, scanTargets(map[string]string{"A": "a", "B": "b"}))
+	return result.extractData
+}
+
+func TestParseAssetConfirmations(t *testing.T) {
+	confirmations, err := ParseAssetConfirmations(" NULS2:6, tNULSeBaNcontract:12 ,")
+	if err != nil {
+		t.Fatalf("ParseAssetConfirmations failed, unexpected error: %v", err)
+	}
+	if len(confirmations) != 2 || confirmations["NULS2"] != 6 || confirmations["tNULSeBaNcontract"] != 12 {
+		t.Errorf("unexpected confirmations: %v", confirmations)
+	}
+
+	for _, v := range []string{"NULS2", ":6", "NULS2:x"} {
+		if _, err := ParseAssetConfirmations(v); err == nil {
+			t.Errorf("asset confirmations %q should be rejected", v)
+		}
+	}
+
+	wc := &WalletConfig{Confirmations: 3, AssetConfirmations: confirmations}
+	if n := wc.MaxConfirmations(); n != 12 {
+		t.Errorf("unexpected max confirmations: %d", n)
+	}
+	contract := openwallet.Coin{Symbol: "NULS2", IsContract: true, Contract: openwallet.SmartContract{Address: "other"}}
+	if n := wc.GetConfirmations(contract); n != 3 {
+		t.Errorf("unexpected confirmations of contract: %d", n)
+	}
+}
+
+func TestTrackConfirmations(t *testing.T) {
+	bs := newTestScanner()
+	bs.wm.Config.Confirmations = 3
+	observer := &testObserver{}
+	bs.AddObserver(observer)
+
+	//首次通知前标记为未确认
+	data := extractTransfer(bs, "tx1", 100)
+	bs.trackConfirmations(100, 99, data)
+	for sourceKey, d := range data {
+		ext := d.Transaction.GetExtParam()
+		if ext.Get("confirmed").Bool() || ext.Get("confirmations").Uint() != 3 || d.Transaction.Confirm != 1 {
+			t.Errorf("%s: unexpected ext param of first notify: %s", sourceKey, d.Transaction.ExtParam)
+		}
+		for _, output := range d.TxOutputs {
+			if output.Confirm != 1 || output.ExtParam == "" {
+				t.Errorf("%s: unexpected output of first notify: %+v", sourceKey, output)
+			}
+		}
+	}
+
+	bs.notifyConfirmedTxs(101)
+	if len(observer.notified) != 0 {
+		t.Fatalf("tx should not be confirmed on height 101")
+	}
+	bs.notifyConfirmedTxs(102)
+	if len(observer.notified) != 2 {
+		t.Fatalf("unexpected confirmed notify count: %d", len(observer.notified))
+	}
+	for _, d := range observer.notified {
+		if !d.Transaction.GetExtParam().Get("confirmed").Bool() || d.Transaction.Confirm != 3 {
+			t.Errorf("unexpected confirmed tx: %+v", d.Transaction)
+		}
+	}
+
+	//重扫已确认的交易不再通知和跟踪
+	data = extractTransfer(bs, "tx1", 100)
+	bs.trackConfirmations(100, 102, data)
+	if len(data) != 0 {
+		t.Errorf("finalized tx should be skipped on rescan: %d", len(data))
+	}
+	bs.notifyConfirmedTxs(103)
+	if len(observer.notified) != 2 || len(bs.confirmTracker.pending) != 0 {
+		t.Errorf("finalized tx should not be notified again: %d", len(observer.notified))
+	}
+
+	//超出重扫范围后不再记录
+	bs.notifyConfirmedTxs(102 + bs.RescanLastBlockCount + 1)
+	if len(bs.confirmTracker.finalized) != 0 {
+		t.Errorf("finalized records should be pruned: %v", bs.confirmTracker.finalized)
+	}
+}
+
+func TestTrackConfirmations_Rescan(t *testing.T) {
+	bs := newTestScanner()
+	bs.wm.Config.Confirmations = 3
+
+	//重扫较早的区块时交易已达到确认数，所有账户都直接通知为已确认
+	data := extractTransfer(bs, "tx1", 100)
+	bs.trackConfirmations(100, 105, data)
+	if len(data) != 2 || len(bs.confirmTracker.pending) != 0 {
+		t.Fatalf("unexpected data: %d, pending: %d", len(data), len(bs.confirmTracker.pending))
+	}
+	for sourceKey, d := range data {
+		if !d.Transaction.GetExtParam().Get("confirmed").Bool() || d.Transaction.Confirm != 6 {
+			t.Errorf("%s: unexpected tx: %+v", sourceKey, d.Transaction)
+		}
+	}
+
+	//分叉后高于共同祖先的记录被移除
+	bs.trackConfirmations(104, 104, extractTransfer(bs, "tx2", 104))
+	bs.dropConfirmations(103)
+	if len(bs.confirmTracker.pending) != 0 || len(bs.confirmTracker.finalized) != 0 {
+		t.Errorf("unexpected records after fork: %d, %d", len(bs.confirmTracker.pending), len(bs.confirmTracker.finalized))
+	}
+}
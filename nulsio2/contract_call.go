@@ -0,0 +1,325 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
+	"github.com/blocktree/openwallet/v2/common"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+)
+
+//isContractCallRawTransaction 扩展参数中是否指定了合约调用
+func isContractCallRawTransaction(rawTx *openwallet.RawTransaction) bool {
+	ext := rawTx.GetExtParam()
+	return ext.Get("contractAddress").Exists() && ext.Get("methodName").Exists()
+}
+
+//parseContractCallArgs 解析合约调用参数，单值参数转为只有一个元素的数组，数组参数保持原样
+func parseContractCallArgs(args gjson.Result) ([][]string, error) {
+	result := make([][]string, 0)
+	if !args.Exists() {
+		return result, nil
+	}
+	if !args.IsArray() {
+		return nil, fmt.Errorf("args of contract call must be an array")
+	}
+	for _, arg := range args.Array() {
+		if arg.IsArray() {
+			elems := make([]string, 0)
+			for _, e := range arg.Array() {
+				if e.IsArray() || e.IsObject() {
+					return nil, fmt.Errorf("args of contract call only support two-dimensional array")
+				}
+				elems = append(elems, e.String())
+			}
+			result = append(result, elems)
+		} else if arg.IsObject() {
+			return nil, fmt.Errorf("args of contract call not support object")
+		} else {
+			result = append(result, []string{arg.String()})
+		}
+	}
+	return result, nil
+}
+
+//CreateContractCallRawTransaction 创建合约调用交易单
+//扩展参数：contractAddress 合约地址，methodName 方法名，methodDesc 方法描述，args 参数数组，
+//value 附带的主币数量(payable方法)，sender 指定调用地址(可选)
+func (decoder *TransactionDecoder) CreateContractCallRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		decimals        = decoder.wm.Decimal()
+		ext             = rawTx.GetExtParam()
+		contractAddress = ext.Get("contractAddress").String()
+		methodName      = ext.Get("methodName").String()
+		methodDesc      = ext.Get("methodDesc").String()
+		value           = decimal.Zero
+	)
+
+	if len(contractAddress) == 0 || len(methodName) == 0 {
+		return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "contract address and method name can not be empty")
+	}
+
+	args, err := parseContractCallArgs(ext.Get("args"))
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "%v", err)
+	}
+
+	if v := ext.Get("value"); v.Exists() && len(v.String()) > 0 {
+		value, err = decimal.NewFromString(v.String())
+		if err != nil || value.LessThan(decimal.Zero) {
+			return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "invalid value: %s", v.String())
+		}
+	}
+	valueAmount := decimalToBigInt(value, decimals)
+
+	searchAddrs, err := decoder.getContractCallSenders(wrapper, rawTx)
+	if err != nil {
+		return err
+	}
+
+	return decoder.createContractCallRawTransaction(wrapper, rawTx, searchAddrs, func(sender string) *nulsio2_trans.TxToken {
+		return &nulsio2_trans.TxToken{
+			Sender:          sender,
+			ContractAddress: contractAddress,
+			Value:           valueAmount,
+			MethodName:      methodName,
+			MethodDesc:      methodDesc,
+			MultiArgs:       args,
+		}
+	})
+}
+
+//getContractCallSenders 获取账户中可作为合约调用者的地址，扩展参数sender指定时只使用该地址
+func (decoder *TransactionDecoder) getContractCallSenders(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]string, error) {
+
+	accountID := rawTx.Account.AccountID
+	sender := rawTx.GetExtParam().Get("sender").String()
+
+	//获取wallet
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		if len(sender) > 0 && address.Address != sender {
+			continue
+		}
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	if len(searchAddrs) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "sender: %s is not belong to account", sender)
+	}
+
+	return searchAddrs, nil
+}
+
+//createContractCallRawTransaction 在候选地址中选择主币余额足够支付附带主币和手续费的地址，创建合约调用交易单
+func (decoder *TransactionDecoder) createContractCallRawTransaction(
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	searchAddrs []string,
+	newToken func(sender string) *nulsio2_trans.TxToken) error {
+
+	var (
+		decimals        = decoder.wm.Decimal()
+		findAddrBalance *AddrBalance
+		fixFees         = big.NewInt(0)
+		token           *nulsio2_trans.TxToken
+	)
+
+	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return err
+	}
+
+	//地址余额从大到小排序
+	sort.Slice(addrBalanceArray, func(i int, j int) bool {
+		a_amount, _ := decimal.NewFromString(addrBalanceArray[i].Balance)
+		b_amount, _ := decimal.NewFromString(addrBalanceArray[j].Balance)
+		return a_amount.GreaterThan(b_amount)
+	})
+
+	for _, addrBalance := range addrBalanceArray {
+
+		addrBalance_BI := common.StringNumToBigIntWithExp(addrBalance.Balance, decimals)
+
+		addrToken := newToken(addrBalance.Address)
+
+		//按调用地址预估gas
+		if err := decoder.wm.EstimateContractGas(addrToken); err != nil {
+			decoder.wm.Log.Errorf("address: %s estimate gas failed, err: %v", addrBalance.Address, err)
+			continue
+		}
+
+		addrFees, err := decoder.estimateTokenFees(addrToken, getRawTransactionRemark(rawTx))
+		if err != nil {
+			return err
+		}
+
+		//总消耗数量 = 附带的主币 + 手续费
+		totalAmount := new(big.Int)
+		if addrToken.Value != nil {
+			totalAmount.Set(addrToken.Value)
+		}
+		totalAmount.Add(totalAmount, addrFees)
+
+		//余额不足查找下一个地址
+		if addrBalance_BI.Cmp(totalAmount) < 0 {
+			continue
+		}
+
+		addrBalanceDecimal := common.BigIntToDecimals(addrFees, decimals)
+
+		//只要找到一个合适使用的地址余额就停止遍历
+		findAddrBalance = &AddrBalance{Address: addrBalance.Address, Balance: &addrBalanceDecimal}
+		fixFees = addrFees
+		token = addrToken
+		break
+	}
+
+	if findAddrBalance == nil {
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "all address's balance of account is not enough")
+	}
+
+	createErr := decoder.createSimpleNrc20RawTransaction(
+		wrapper,
+		rawTx,
+		findAddrBalance,
+		fixFees,
+		"", token)
+	if createErr != nil {
+		return createErr
+	}
+
+	return nil
+}
+
+//NRC20标准中除transfer外支持构建的方法
+const (
+	Nrc20MethodApprove          = "approve"
+	Nrc20MethodIncreaseApproval = "increaseApproval"
+	Nrc20MethodDecreaseApproval = "decreaseApproval"
+	Nrc20MethodTransferFrom     = "transferFrom"
+)
+
+//isNrc20MethodRawTransaction 扩展参数中是否指定了NRC20授权类方法
+func isNrc20MethodRawTransaction(rawTx *openwallet.RawTransaction) bool {
+	method := rawTx.GetExtParam().Get("nrc20Method").String()
+	return len(method) > 0 && method != "transfer"
+}
+
+//CreateNrc20MethodRawTransaction 创建NRC20授权类合约调用交易单
+//扩展参数：nrc20Method 方法名(approve/increaseApproval/decreaseApproval/transferFrom)，
+//from 代币所有者地址(transferFrom时必填)，sender 指定调用地址(可选)
+//rawTx.To 只能有一个，approve类方法为被授权地址和额度，transferFrom为接收地址和数量
+func (decoder *TransactionDecoder) CreateNrc20MethodRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		ext             = rawTx.GetExtParam()
+		method          = ext.Get("nrc20Method").String()
+		from            = ext.Get("from").String()
+		contractAddress = rawTx.Coin.Contract.Address
+		tokenDecimal    = int32(rawTx.Coin.Contract.Decimals)
+		to              string
+		amountStr       string
+	)
+
+	if len(rawTx.To) != 1 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "nrc20 %s only support one receiver", method)
+	}
+
+	for addr, amount := range rawTx.To {
+		to = addr
+		amountStr = amount
+	}
+
+	amountDe, err := decimal.NewFromString(amountStr)
+	if err != nil || amountDe.LessThan(decimal.Zero) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s", amountStr)
+	}
+	amount := common.StringNumToBigIntWithExp(amountStr, tokenDecimal)
+
+	searchAddrs, err := decoder.getContractCallSenders(wrapper, rawTx)
+	if err != nil {
+		return err
+	}
+
+	var args []string
+	switch method {
+	case Nrc20MethodApprove, Nrc20MethodIncreaseApproval, Nrc20MethodDecreaseApproval:
+		args = []string{to, amount.String()}
+	case Nrc20MethodTransferFrom:
+		if len(from) == 0 {
+			return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "from address of transferFrom can not be empty")
+		}
+
+		//代币所有者的余额
+		fromBalance, err := decoder.wm.Api.GetTokenBalances(contractAddress, from)
+		if err != nil {
+			return openwallet.Errorf(openwalletErrorCode(err, openwallet.ErrCallFullNodeAPIFailed), "get token balance of %s failed, err: %v", from, err)
+		}
+		if fromBalance.LessThan(amountDe) {
+			return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "token balance of %s is not enough", from)
+		}
+
+		//只保留授权额度足够的调用地址
+		spenders := make([]string, 0)
+		for _, addr := range searchAddrs {
+			allowance, err := decoder.wm.Api.GetAllowance(contractAddress, from, addr)
+			if err != nil {
+				if IsRetryable(err) {
+					return toOpenwalletError(err, openwallet.ErrCallFullNodeAPIFailed)
+				}
+				decoder.wm.Log.Errorf("get allowance of address: %s failed, err: %v", addr, err)
+				continue
+			}
+			if allowance.Cmp(amount) >= 0 {
+				spenders = append(spenders, addr)
+			}
+		}
+		if len(spenders) == 0 {
+			return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "allowance of %s to account is not enough", from)
+		}
+		searchAddrs = spenders
+		args = []string{from, to, amount.String()}
+	default:
+		return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "nrc20 method: %s is not supported", method)
+	}
+
+	return decoder.createContractCallRawTransaction(wrapper, rawTx, searchAddrs, func(sender string) *nulsio2_trans.TxToken {
+		return &nulsio2_trans.TxToken{
+			Sender:          sender,
+			ContractAddress: contractAddress,
+			MethodName:      method,
+			ArgsCount:       int64(len(args)),
+			Args:            args,
+		}
+	})
+}
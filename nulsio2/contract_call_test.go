@@ -0,0 +1,229 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+//contractNodeHandlers 合约调用需要的节点接口，gas预估为20000，gas单价为25，
+//合约只读方法由view按方法名和参数返回结果
+func contractNodeHandlers(view func(methodName string, args []gjson.Result) string) map[string]func(r *http.Request) string {
+	return map[string]func(r *http.Request) string{
+		"/api/contract/imputedgas/call": func(r *http.Request) string {
+			return `{"gasLimit":20000}`
+		},
+		"/api/contract/price": func(r *http.Request) string {
+			return `25`
+		},
+		"/api/contract/view": func(r *http.Request) string {
+			body, _ := ioutil.ReadAll(r.Body)
+			params := gjson.ParseBytes(body)
+			return view(params.Get("methodName").String(), params.Get("args").Array())
+		},
+	}
+}
+
+//decodeTestTxToken 解析交易单中的合约调用数据
+func decodeTestTxToken(t *testing.T, rawHex string) (*nulsio2_trans.Transaction, *nulsio2_trans.TxToken) {
+	t.Helper()
+	txBytes, _ := hex.DecodeString(rawHex)
+	trx, err := nulsio2_trans.DecodeRawTransaction(txBytes)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction failed, unexpected error: %v", err)
+	}
+	token, err := nulsio2_trans.DecodeTxToken(trx.TxData)
+	if err != nil {
+		t.Fatalf("DecodeTxToken failed, unexpected error: %v", err)
+	}
+	return trx, token
+}
+
+func TestParseContractCallArgs(t *testing.T) {
+	cases := []struct {
+		args   string
+		result string
+		fail   bool
+	}{
+		{``, `[]`, false},
+		//单值参数转为只有一个元素的数组
+		{`["NULSd6Hgh", 100, true]`, `[[NULSd6Hgh] [100] [true]]`, false},
+		{`[["a", "b"], "c", []]`, `[[a b] [c] []]`, false},
+		{`"a"`, ``, true},
+		{`[{"a": 1}]`, ``, true},
+		{`[[["a"]]]`, ``, true},
+		{`[["a", {"b": 1}]]`, ``, true},
+	}
+
+	for _, c := range cases {
+		args, err := parseContractCallArgs(gjson.Parse(c.args))
+		if c.fail {
+			if err == nil {
+				t.Errorf("args %s should be rejected", c.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("args %s: parseContractCallArgs failed, unexpected error: %v", c.args, err)
+			continue
+		}
+		if fmt.Sprint(args) != c.result {
+			t.Errorf("args %s: unexpected result: %v", c.args, args)
+		}
+	}
+}
+
+func TestCreateContractCallRawTransaction(t *testing.T) {
+	var (
+		sender   = testAddress(1)
+		contract = testAddress(90)
+	)
+	server := newTestNode(map[string]string{sender: "1000000000"}, contractNodeHandlers(nil))
+	defer server.Close()
+
+	cases := []struct {
+		name   string
+		ext    string
+		args   string
+		value  string
+		amount string
+		code   uint64
+	}{
+		{"scalar", `"methodName":"stake","methodDesc":"(BigInteger amount) void","args":["100"],"value":"1.5"`, "[[100]]", "150000000", "-1.50700000", 0},
+		{"array", `"methodName":"vote","args":[["` + sender + `","` + contract + `"],"2"]`, "[[" + sender + " " + contract + "] [2]]", "0", "-0.00700000", 0},
+		{"object", `"methodName":"vote","args":[{"a":1}]`, "", "", "", openwallet.ErrContractCallMsgInvalid},
+		{"nested array", `"methodName":"vote","args":[[["a"]]]`, "", "", "", openwallet.ErrContractCallMsgInvalid},
+		{"negative value", `"methodName":"stake","args":["100"],"value":"-1"`, "", "", "", openwallet.ErrContractCallMsgInvalid},
+		{"empty method", `"methodName":""`, "", "", "", openwallet.ErrContractCallMsgInvalid},
+		{"other sender", `"methodName":"stake","sender":"` + contract + `"`, "", "", "", openwallet.ErrAddressNotFound},
+	}
+
+	for _, c := range cases {
+		decoder := newTestDecoder(server.URL)
+		rawTx := newTestRawTransaction(nil)
+		rawTx.ExtParam = `{"contractAddress":"` + contract + `",` + c.ext + `}`
+
+		err := decoder.CreateContractCallRawTransaction(&testWalletDAI{addresses: []string{sender}}, rawTx)
+		if c.code != 0 {
+			if errorCode(err) != c.code {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: CreateContractCallRawTransaction failed, unexpected error: %v", c.name, err)
+			continue
+		}
+
+		trx, token := decodeTestTxToken(t, rawTx.RawHex)
+		ext := rawTx.GetExtParam()
+		if token.Sender != sender || token.ContractAddress != contract || token.MethodName != ext.Get("methodName").String() ||
+			token.MethodDesc != ext.Get("methodDesc").String() {
+			t.Errorf("%s: unexpected token: %+v", c.name, token)
+		}
+		if fmt.Sprint(token.MultiArgs) != c.args || token.Value.String() != c.value {
+			t.Errorf("%s: unexpected args: %v, value: %s", c.name, token.MultiArgs, token.Value.String())
+		}
+		//gas按安全系数放大
+		if token.GasLimit != 24000 || token.Price != 25 {
+			t.Errorf("%s: unexpected gas: %d, price: %d", c.name, token.GasLimit, token.Price)
+		}
+
+		//附带的主币转入合约地址
+		vouts := trx.GetVouts()
+		if c.value != "0" && (len(vouts) != 1 || vouts[0].Address != contract || vouts[0].Amount.String() != c.value) {
+			t.Errorf("%s: unexpected outputs: %+v", c.name, vouts)
+		}
+		if rawTx.Fees != "0.00700000" || rawTx.TxAmount != c.amount {
+			t.Errorf("%s: unexpected fees: %s, amount: %s", c.name, rawTx.Fees, rawTx.TxAmount)
+		}
+	}
+}
+
+func TestCreateNrc20MethodRawTransaction_TransferFrom(t *testing.T) {
+	var (
+		owner    = testAddress(100)
+		spender1 = testAddress(1)
+		spender2 = testAddress(21)
+		receiver = testAddress(50)
+		contract = testAddress(90)
+	)
+
+	//spender1的主币余额更多，授权额度为5，spender2的授权额度为20，owner的代币余额为10
+	allowances := map[string]string{spender1: "500000000", spender2: "2000000000"}
+	handlers := contractNodeHandlers(func(methodName string, args []gjson.Result) string {
+		if methodName != "allowance" || len(args) != 2 || args[0].String() != owner {
+			return ""
+		}
+		return fmt.Sprintf(`{"result":"%s"}`, allowances[args[1].String()])
+	})
+	handlers["/api/contract/balance/token/"+contract+"/"+owner] = func(r *http.Request) string {
+		return `{"amount":"1000000000","decimals":8}`
+	}
+	server := newTestNode(map[string]string{spender1: "2000000000", spender2: "1000000000"}, handlers)
+	defer server.Close()
+
+	cases := []struct {
+		name   string
+		amount string
+		from   string
+		sender string
+		code   uint64
+	}{
+		//授权额度都足够时使用主币余额最多的地址
+		{"both allowed", "5", owner, spender1, 0},
+		//只保留授权额度足够的地址
+		{"allowance filtered", "8", owner, spender2, 0},
+		{"allowance not enough", "10.5", owner, "", openwallet.ErrInsufficientBalanceOfAddress},
+		{"owner balance not enough", "15", owner, "", openwallet.ErrInsufficientBalanceOfAddress},
+		{"empty from", "5", "", "", openwallet.ErrContractCallMsgInvalid},
+	}
+
+	for _, c := range cases {
+		decoder := newTestDecoder(server.URL)
+		rawTx := newTestRawTransaction(map[string]string{receiver: c.amount})
+		rawTx.Coin = openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: contract, Decimals: 8}}
+		rawTx.ExtParam = `{"nrc20Method":"transferFrom","from":"` + c.from + `"}`
+
+		err := decoder.CreateNrc20MethodRawTransaction(&testWalletDAI{addresses: []string{spender1, spender2}}, rawTx)
+		if c.code != 0 {
+			if errorCode(err) != c.code {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: CreateNrc20MethodRawTransaction failed, unexpected error: %v", c.name, err)
+			continue
+		}
+
+		_, token := decodeTestTxToken(t, rawTx.RawHex)
+		amount := fmt.Sprintf("%s00000000", c.amount)
+		if token.Sender != c.sender || token.MethodName != Nrc20MethodTransferFrom || fmt.Sprint(token.MultiArgs) != fmt.Sprintf("[[%s] [%s] [%s]]", owner, receiver, amount) {
+			t.Errorf("%s: unexpected token: %+v", c.name, token)
+		}
+		if keySigs := rawTx.Signatures["account"]; len(keySigs) != 1 || keySigs[0].Address.Address != c.sender {
+			t.Errorf("%s: unexpected signatures: %+v", c.name, keySigs)
+		}
+	}
+}
@@ -120,7 +120,17 @@ func (this *NulsContractDecoder) GetTokenBalanceByAddress(contract openwallet.Sm
 			<-threadControl
 		}()
 
-		balanceTemp, err := this.wm.Api.GetTokenBalancesReal(contract.Address, address)
+		var (
+			balanceTemp decimal.Decimal
+			err         error
+		)
+		if IsAssetContract(contract) {
+			balanceTemp, err = this.wm.getAssetBalance(contract.Address, address)
+		} else if IsNrc721Contract(contract) {
+			balanceTemp, err = this.GetNrc721Balance(contract, address)
+		} else {
+			balanceTemp, err = this.wm.Api.GetTokenBalancesReal(contract.Address, address)
+		}
 		if err != nil {
 			log.Errorf("get address[%v] nrc20 token balance failed, err=%v", address, err)
 			return
@@ -154,3 +164,17 @@ func (this *NulsContractDecoder) GetTokenBalanceByAddress(contract openwallet.Sm
 	}
 	return tokenBalanceList, nil
 }
+
+//GetNrc721OwnerOf 查询NRC721的tokenId所有者
+func (this *NulsContractDecoder) GetNrc721OwnerOf(contract openwallet.SmartContract, tokenId string) (string, error) {
+	return this.wm.Api.GetNrc721OwnerOf(contract.Address, tokenId)
+}
+
+//GetNrc721Balance 查询地址持有的NRC721数量
+func (this *NulsContractDecoder) GetNrc721Balance(contract openwallet.SmartContract, address string) (decimal.Decimal, error) {
+	balance, err := this.wm.Api.GetNrc721Balance(contract.Address, address)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromBigInt(balance, 0), nil
+}
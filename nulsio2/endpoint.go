@@ -0,0 +1,284 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	//节点落后最高节点超过该区块数时移出轮换
+	DefaultMaxHeightLag = int64(10)
+	//节点健康检查的默认间隔
+	DefaultHealthCheckInterval = 60 * time.Second
+)
+
+//Endpoint 节点API地址
+type Endpoint struct {
+	URL      string
+	Priority int //数值越小优先级越高
+
+	healthy bool
+	height  int64
+}
+
+//endpointPool 多节点池，按健康状态和优先级选择节点，健康状态由后台检查更新
+type endpointPool struct {
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	cancel    context.CancelFunc //停止后台健康检查
+}
+
+//ParseEndpoints 解析节点列表，格式为 "url|优先级,url|优先级"，未填优先级时按顺序排列
+func ParseEndpoints(s string) ([]*Endpoint, error) {
+	endpoints := make([]*Endpoint, 0)
+	for i, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		endpoint := &Endpoint{URL: item, Priority: i, healthy: true}
+		if idx := strings.LastIndex(item, "|"); idx > 0 {
+			priority, err := strconv.Atoi(strings.TrimSpace(item[idx+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority of endpoint: %s", item)
+			}
+			endpoint.URL = strings.TrimSpace(item[:idx])
+			endpoint.Priority = priority
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if len(endpoints) == 0 {
+		return nil, errors.New("endpoints is empty")
+	}
+
+	return endpoints, nil
+}
+
+//SetEndpoints 设置多个节点，请求失败时按优先级切换到其他健康节点
+func (c *Client) SetEndpoints(endpoints []*Endpoint) {
+	for _, e := range endpoints {
+		e.healthy = true
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+	c.StopHealthCheck()
+	c.pool = &endpointPool{endpoints: endpoints}
+	if len(endpoints) > 0 {
+		c.BaseURL = endpoints[0].URL
+	}
+}
+
+//endpointURLs 本次请求可使用的节点，健康节点按优先级在前，不健康的节点作为最后的备选
+func (c *Client) endpointURLs() []string {
+	if c.pool == nil {
+		return []string{c.BaseURL}
+	}
+
+	c.pool.mu.RLock()
+	defer c.pool.mu.RUnlock()
+
+	healthy := make([]string, 0, len(c.pool.endpoints))
+	unhealthy := make([]string, 0)
+	for _, e := range c.pool.endpoints {
+		if e.healthy {
+			healthy = append(healthy, e.URL)
+		} else {
+			unhealthy = append(unhealthy, e.URL)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+//healthyEndpointURLs 所有健康的节点
+func (c *Client) healthyEndpointURLs() []string {
+	if c.pool == nil {
+		return []string{c.BaseURL}
+	}
+
+	c.pool.mu.RLock()
+	defer c.pool.mu.RUnlock()
+
+	urls := make([]string, 0, len(c.pool.endpoints))
+	for _, e := range c.pool.endpoints {
+		if e.healthy {
+			urls = append(urls, e.URL)
+		}
+	}
+	return urls
+}
+
+//markEndpointFailed 请求失败的节点移出轮换，等待下次健康检查恢复
+func (c *Client) markEndpointFailed(url string) {
+	if c.pool == nil {
+		return
+	}
+
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	for _, e := range c.pool.endpoints {
+		if e.URL == url {
+			e.healthy = false
+		}
+	}
+}
+
+//StartHealthCheck 启动后台健康检查，立即检查一次后按HealthCheckInterval定时检查，请求只读取节点池的状态
+func (c *Client) StartHealthCheck() {
+	if c.pool == nil {
+		return
+	}
+
+	c.StopHealthCheck()
+
+	interval := c.HealthCheckInterval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.pool.mu.Lock()
+	c.pool.cancel = cancel
+	c.pool.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		c.CheckEndpoints(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.CheckEndpoints(ctx)
+			}
+		}
+	}()
+}
+
+//StopHealthCheck 停止后台健康检查
+func (c *Client) StopHealthCheck() {
+	if c.pool == nil {
+		return
+	}
+
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	if c.pool.cancel != nil {
+		c.pool.cancel()
+		c.pool.cancel = nil
+	}
+}
+
+//CheckEndpoints 比较各节点的最新高度，请求失败或落后最高节点超过MaxHeightLag的节点移出轮换
+func (c *Client) CheckEndpoints(ctx context.Context) {
+	if c.pool == nil {
+		return
+	}
+
+	c.pool.mu.RLock()
+	endpoints := make([]*Endpoint, len(c.pool.endpoints))
+	copy(endpoints, c.pool.endpoints)
+	c.pool.mu.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		heights = make([]int64, len(endpoints))
+		errs    = make([]error, len(endpoints))
+	)
+
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			heights[i], errs[i] = c.getEndpointHeight(ctx, url)
+		}(i, e.URL)
+	}
+	wg.Wait()
+
+	maxHeight := int64(0)
+	for i := range endpoints {
+		if errs[i] == nil && heights[i] > maxHeight {
+			maxHeight = heights[i]
+		}
+	}
+
+	maxLag := c.MaxHeightLag
+	if maxLag <= 0 {
+		maxLag = DefaultMaxHeightLag
+	}
+
+	//检查已停止时不再更新节点状态
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	for i, e := range endpoints {
+		e.height = heights[i]
+		switch {
+		case errs[i] != nil:
+			e.healthy = false
+			log.Warningf("endpoint %s is unhealthy, err: %v", e.URL, errs[i])
+		case maxHeight-heights[i] > maxLag:
+			e.healthy = false
+			log.Warningf("endpoint %s is unhealthy, height: %d is behind %d", e.URL, heights[i], maxHeight)
+		default:
+			e.healthy = true
+		}
+	}
+}
+
+//getEndpointHeight 获取指定节点的最新高度
+func (c *Client) getEndpointHeight(ctx context.Context, url string) (int64, error) {
+	if c.isJSONRPC() {
+		return c.getEndpointHeightJSONRPC(ctx, url)
+	}
+
+	r, err := c.doRequestURL(ctx, "GET", url+"/api/block/newest", false)
+	if err != nil {
+		return 0, err
+	}
+
+	resp := gjson.ParseBytes(r.Bytes())
+	if err := isError(&resp); err != nil {
+		return 0, err
+	}
+
+	height := resp.Get("data.header.height")
+	if !height.Exists() {
+		return 0, errors.New("height of newest block is empty")
+	}
+
+	return height.Int(), nil
+}
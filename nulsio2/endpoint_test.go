@@ -0,0 +1,199 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//newHeightServer 返回指定最新高度的节点
+func newHeightServer(height int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success":true,"data":{"header":{"height":%d}}}`, height)
+	}))
+}
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints("http://a|2, http://b ,http://c|0")
+	if err != nil {
+		t.Fatalf("ParseEndpoints failed, unexpected error: %v", err)
+	}
+	expected := []struct {
+		url      string
+		priority int
+	}{
+		{"http://a", 2},
+		{"http://b", 1},
+		{"http://c", 0},
+	}
+	if len(endpoints) != len(expected) {
+		t.Fatalf("unexpected endpoints count: %d", len(endpoints))
+	}
+	for i, e := range expected {
+		if endpoints[i].URL != e.url || endpoints[i].Priority != e.priority {
+			t.Errorf("unexpected endpoint %d: %+v", i, endpoints[i])
+		}
+	}
+
+	invalids := []string{"", " , ", "http://a|x"}
+	for _, v := range invalids {
+		if _, err := ParseEndpoints(v); err == nil {
+			t.Errorf("endpoints %q should be rejected", v)
+		}
+	}
+}
+
+func TestDoRequest_Failover(t *testing.T) {
+	var failedCalls, calls int32
+	failed := newFlakyServer(100, http.StatusBadGateway, "", &failedCalls)
+	defer failed.Close()
+	healthy := newFlakyServer(0, http.StatusOK, `{"success":true,"data":{"height":100}}`, &calls)
+	defer healthy.Close()
+
+	client := newTestClient("")
+	client.MaxRetries = 1
+	client.SetEndpoints([]*Endpoint{
+		{URL: failed.URL, Priority: 0},
+		{URL: healthy.URL, Priority: 1},
+	})
+	if client.BaseURL != failed.URL {
+		t.Errorf("base url should be the endpoint of highest priority: %s", client.BaseURL)
+	}
+
+	result, err := client.CallReq("/api/block/newest")
+	if err != nil {
+		t.Fatalf("CallReq failed, unexpected error: %v", err)
+	}
+	if result.Get("height").Int() != 100 {
+		t.Errorf("unexpected result: %s", result.Raw)
+	}
+	if failedCalls != 2 || calls != 1 {
+		t.Errorf("unexpected request count, failed: %d, healthy: %d", failedCalls, calls)
+	}
+
+	//失败的节点移到最后，下次请求直接使用健康节点
+	urls := client.endpointURLs()
+	if len(urls) != 2 || urls[0] != healthy.URL || urls[1] != failed.URL {
+		t.Errorf("unexpected endpoint order: %v", urls)
+	}
+	if _, err := client.CallReq("/api/block/newest"); err != nil {
+		t.Fatalf("CallReq failed, unexpected error: %v", err)
+	}
+	if failedCalls != 2 || calls != 2 {
+		t.Errorf("unexpected request count, failed: %d, healthy: %d", failedCalls, calls)
+	}
+}
+
+func TestDoRequest_AllEndpointsFailed(t *testing.T) {
+	var callsA, callsB int32
+	a := newFlakyServer(100, http.StatusInternalServerError, "", &callsA)
+	defer a.Close()
+	b := newFlakyServer(100, http.StatusInternalServerError, "", &callsB)
+	defer b.Close()
+
+	client := newTestClient("")
+	client.MaxRetries = 0
+	client.SetEndpoints([]*Endpoint{{URL: a.URL}, {URL: b.URL, Priority: 1}})
+
+	_, err := client.CallReq("/api/block/newest")
+	if !IsRetryable(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if callsA != 1 || callsB != 1 {
+		t.Errorf("unexpected request count: %d, %d", callsA, callsB)
+	}
+
+	//全部不健康时仍按优先级尝试
+	if urls := client.endpointURLs(); len(urls) != 2 || urls[0] != a.URL {
+		t.Errorf("unexpected endpoint order: %v", urls)
+	}
+}
+
+func TestCheckEndpoints_LaggingExcluded(t *testing.T) {
+	best := newHeightServer(100)
+	defer best.Close()
+	near := newHeightServer(95)
+	defer near.Close()
+	lagging := newHeightServer(80)
+	defer lagging.Close()
+
+	client := newTestClient("")
+	client.MaxHeightLag = 10
+	client.SetEndpoints([]*Endpoint{
+		{URL: lagging.URL, Priority: 0},
+		{URL: best.URL, Priority: 1},
+		{URL: near.URL, Priority: 2},
+	})
+
+	client.CheckEndpoints(context.Background())
+
+	healthy := client.healthyEndpointURLs()
+	if len(healthy) != 2 || healthy[0] != best.URL || healthy[1] != near.URL {
+		t.Errorf("unexpected healthy endpoints: %v", healthy)
+	}
+	urls := client.endpointURLs()
+	if len(urls) != 3 || urls[2] != lagging.URL {
+		t.Errorf("lagging endpoint should be the last one: %v", urls)
+	}
+
+	//不可用的节点同样移出轮换
+	best.Close()
+	client.CheckEndpoints(context.Background())
+	healthy = client.healthyEndpointURLs()
+	if len(healthy) != 1 || healthy[0] != near.URL {
+		t.Errorf("unexpected healthy endpoints: %v", healthy)
+	}
+}
+
+func TestStartHealthCheck(t *testing.T) {
+	var lagged int32
+	best := newHeightServer(100)
+	defer best.Close()
+	lagging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		height := 100
+		if atomic.LoadInt32(&lagged) == 1 {
+			height = 50
+		}
+		fmt.Fprintf(w, `{"success":true,"data":{"header":{"height":%d}}}`, height)
+	}))
+	defer lagging.Close()
+
+	client := newTestClient("")
+	client.HealthCheckInterval = 10 * time.Millisecond
+	client.SetEndpoints([]*Endpoint{{URL: lagging.URL}, {URL: best.URL, Priority: 1}})
+	client.StartHealthCheck()
+	defer client.StopHealthCheck()
+
+	//后台检查更新节点状态，不需要发起请求
+	atomic.StoreInt32(&lagged, 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		healthy := client.healthyEndpointURLs()
+		if len(healthy) == 1 && healthy[0] == best.URL {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lagging endpoint is not excluded by background check: %v", healthy)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+//节点返回错误的类型，通过 IsNodeError 或 errors.Is 判断
+var (
+	//数据不存在，如交易、区块或地址
+	ErrNotFound = errors.New("data not found")
+	//交易已存在
+	ErrTxExists = errors.New("transaction already exists")
+	//nonce冲突，如双花或孤儿交易
+	ErrNonceConflict = errors.New("nonce conflict")
+	//手续费不足
+	ErrInsufficientFee = errors.New("insufficient fee")
+	//余额不足
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	//签名无效
+	ErrInvalidSignature = errors.New("invalid signature")
+	//节点不可用，如网络错误、超时或服务端错误
+	ErrNodeUnavailable = errors.New("node unavailable")
+	//其他节点错误
+	ErrNodeResponse = errors.New("node response error")
+)
+
+//NodeError 节点返回的错误
+type NodeError struct {
+	Kind    error  //错误类型
+	Code    string //NULS错误码
+	Message string //错误信息
+}
+
+func (e *NodeError) Error() string {
+	if len(e.Code) > 0 {
+		return fmt.Sprintf("%v: [%s]%s", e.Kind, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+}
+
+//Unwrap 返回错误类型，支持 errors.Is
+func (e *NodeError) Unwrap() error {
+	return e.Kind
+}
+
+//nodeErrorMessages 错误信息关键字对应的错误类型，按顺序匹配
+var nodeErrorMessages = []struct {
+	keywords []string
+	kind     error
+}{
+	{[]string{"already exist", "repeated", "duplicate"}, ErrTxExists},
+	{[]string{"not exist", "not found", "can not find", "can't find"}, ErrNotFound},
+	{[]string{"nonce", "double spend", "double expense", "orphan"}, ErrNonceConflict},
+	{[]string{"fee not enough", "fee is not enough", "insufficient fee", "fee not right"}, ErrInsufficientFee},
+	{[]string{"balance not enough", "balance is not enough", "insufficient balance", "insufficient"}, ErrInsufficientBalance},
+	{[]string{"signature", "sign error", "verify sign"}, ErrInvalidSignature},
+	{[]string{"timeout", "time out", "busy", "unavailable", "connection"}, ErrNodeUnavailable},
+}
+
+var (
+	nodeErrorCodesMu sync.RWMutex
+	//nodeErrorCodes NULS错误码对应的错误类型，优先于错误信息匹配，
+	//tx_开头为交易模块(TxErrorCode)，lg_开头为账本模块(LedgerErrorCode)
+	nodeErrorCodes = map[string]error{
+		"tx_0002": ErrInsufficientFee,     //FEE_NOT_RIGHT
+		"tx_0003": ErrInsufficientFee,     //INSUFFICIENT_FEE
+		"tx_0012": ErrNotFound,            //TX_NOT_EXIST
+		"tx_0013": ErrTxExists,            //TX_ALREADY_EXISTS
+		"tx_0014": ErrTxExists,            //TX_REPEATED
+		"tx_0017": ErrInvalidSignature,    //SIGNATURE_ERROR
+		"tx_0018": ErrNonceConflict,       //ORPHAN_TX
+		"lg_0001": ErrNonceConflict,       //ORPHAN
+		"lg_0002": ErrNonceConflict,       //DOUBLE_EXPENSES
+		"lg_0003": ErrTxExists,            //TX_EXIST
+		"lg_0004": ErrInsufficientBalance, //BALANCE_NOT_ENOUGH
+		"lg_0005": ErrNonceConflict,       //NONCE_ERROR
+	}
+)
+
+//RegisterNodeErrorCode 注册或覆盖NULS错误码对应的错误类型，用于适配不同版本的节点
+func RegisterNodeErrorCode(code string, kind error) {
+	nodeErrorCodesMu.Lock()
+	defer nodeErrorCodesMu.Unlock()
+	nodeErrorCodes[code] = kind
+}
+
+//newNodeError 根据NULS错误码和错误信息创建节点错误
+func newNodeError(code, message string) *NodeError {
+	nodeErrorCodesMu.RLock()
+	kind, ok := nodeErrorCodes[code]
+	nodeErrorCodesMu.RUnlock()
+
+	if !ok {
+		kind = ErrNodeResponse
+		msg := strings.ToLower(message)
+	match:
+		for _, m := range nodeErrorMessages {
+			for _, keyword := range m.keywords {
+				if strings.Contains(msg, keyword) {
+					kind = m.kind
+					break match
+				}
+			}
+		}
+	}
+
+	return &NodeError{Kind: kind, Code: code, Message: message}
+}
+
+//parseNodeError 解析节点返回的错误内容，兼容 {code, msg} 和 {code, message} 格式
+func parseNodeError(result gjson.Result) *NodeError {
+	if result.Type != gjson.JSON {
+		return newNodeError("", result.String())
+	}
+	code := rpcString(result, "code", "data.code", "error.code")
+	message := rpcString(result, "msg", "message", "data.msg", "error.message", "data.message")
+	if len(message) == 0 {
+		message = result.Raw
+	}
+	return newNodeError(code, message)
+}
+
+//nodeUnavailable 网络请求失败的节点错误
+func nodeUnavailable(err error) *NodeError {
+	return &NodeError{Kind: ErrNodeUnavailable, Message: err.Error()}
+}
+
+//IsNodeError 错误是否为指定类型的节点错误
+func IsNodeError(err error, kind error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, kind)
+}
+
+//IsRetryable 错误是否可以安全重试，只有节点不可用的错误可以重试
+func IsRetryable(err error) bool {
+	return IsNodeError(err, ErrNodeUnavailable)
+}
+
+//openwalletErrorCode 节点错误对应的openwallet错误码，无对应时使用defaultCode
+func openwalletErrorCode(err error, defaultCode uint64) uint64 {
+	var e *NodeError
+	if !errors.As(err, &e) {
+		return defaultCode
+	}
+	switch e.Kind {
+	case ErrNonceConflict:
+		return openwallet.ErrNonceInvaild
+	case ErrInsufficientFee:
+		return openwallet.ErrInsufficientFees
+	case ErrInsufficientBalance:
+		return openwallet.ErrInsufficientBalanceOfAddress
+	case ErrInvalidSignature:
+		return openwallet.ErrVerifyRawTransactionFailed
+	case ErrNodeUnavailable:
+		return openwallet.ErrCallFullNodeAPIFailed
+	}
+	return defaultCode
+}
+
+//toOpenwalletError 转换为openwallet错误，无对应错误码时使用defaultCode
+func toOpenwalletError(err error, defaultCode uint64) error {
+	if err == nil {
+		return nil
+	}
+	var owErr *openwallet.Error
+	if errors.As(err, &owErr) {
+		return owErr
+	}
+	return openwallet.Errorf(openwalletErrorCode(err, defaultCode), "%v", err)
+}
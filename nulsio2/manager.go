@@ -16,7 +16,11 @@
 package nulsio2
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/blocktree/nulsio2-adapter/nulsio2_addrdec"
+	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/shopspring/decimal"
@@ -39,7 +43,7 @@ type WalletManager struct {
 func NewWalletManager() *WalletManager {
 	wm := WalletManager{}
 	wm.Config = NewConfig(Symbol)
-	wm.Api = new(Client)
+	wm.Api = NewClient("", false)
 	wm.Blockscanner = NewNULSBlockScanner(&wm)
 	wm.Decoder = NewAddressDecoder(&wm)
 	wm.TxDecoder = NewTransactionDecoder(&wm)
@@ -51,27 +55,89 @@ func NewWalletManager() *WalletManager {
 
 //EstimateFee 预估手续费
 func (wm *WalletManager) EstimateFee(inputs, outputs int64, remark string, feeRate decimal.Decimal) (decimal.Decimal, error) {
+	return wm.EstimateTxFee(int(inputs), int(outputs), int(inputs), remark, 0, feeRate), nil
+}
+
+//EstimateTxFee 按交易单字节数计算手续费，字节数包含未签名交易单和每个签名者的签名，
+//每KB收取feeRate，不足1KB按1KB计算，且不低于最低手续费FixFees
+func (wm *WalletManager) EstimateTxFee(inputs, outputs, signers int, remark string, txDataLen int, feeRate decimal.Decimal) decimal.Decimal {
 
-	var base int64 = 124
+	size := nulsio2_trans.EstimateTxSize(inputs, outputs, []byte(remark), txDataLen, signers)
+	kb := (size + 1023) / 1024
 
-	// int size = 124 + 50 * inputs.size() + 38 * outputs.size() + remark.getBytes().length;
-	trx_bytes := decimal.New(inputs*50+outputs*38+base+int64(len([]byte(remark))), 0)
-	trx_fee := trx_bytes.Div(decimal.New(1000, 0)).Mul(feeRate)
+	trx_fee := feeRate.Mul(decimal.New(kb, 0))
 	trx_fee = trx_fee.Round(wm.Decimal())
-	trx_fee, _ = decimal.NewFromString("0.005") //暂时默认啦
-	return trx_fee, nil
+
+	minFee, _ := decimal.NewFromString(wm.Config.FixFees)
+	if trx_fee.LessThan(minFee) {
+		trx_fee = minFee
+	}
+	return trx_fee
+}
+
+//EstimateTokenFee 预估合约调用手续费 = gasLimit * price + 按字节数计算的手续费
+func (wm *WalletManager) EstimateTokenFee(token *nulsio2_trans.TxToken, remark string, feeRate decimal.Decimal) decimal.Decimal {
+
+	gasFee := decimal.New(int64(token.GasLimit*token.Price), -wm.Decimal())
+
+	//合约调用只有一个支付手续费的输入，附带主币时有一个转入合约的输出
+	outputs := 0
+	if token.Value != nil && token.Value.Sign() > 0 {
+		outputs = 1
+	}
+	return gasFee.Add(wm.EstimateTxFee(1, outputs, 1, remark, token.Size(), feeRate))
+}
+
+//EstimateContractGas 通过节点预估合约调用的gasLimit和gas单价，gasLimit按安全系数放大
+func (wm *WalletManager) EstimateContractGas(token *nulsio2_trans.TxToken) error {
+
+	//单值参数按字符串传递，多值参数按数组传递
+	args := make([]interface{}, 0)
+	for _, arg := range token.GetArgs() {
+		if len(arg) == 1 {
+			args = append(args, arg[0])
+		} else {
+			args = append(args, arg)
+		}
+	}
+
+	gasLimit, err := wm.Api.ImputedContractCallGas(token.Sender, token.Value, token.ContractAddress, token.MethodName, token.MethodDesc, args)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "estimate gas of contract call failed: %v", err)
+	}
+
+	margin := wm.Config.GasSafetyMargin
+	if margin < 1 {
+		margin = 1
+	}
+	gasLimit = uint64(math.Ceil(float64(gasLimit) * margin))
+	if gasLimit > MaxContractGasLimit {
+		gasLimit = MaxContractGasLimit
+	}
+
+	price, err := wm.Api.GetContractPrice()
+	if err != nil || price < MinContractGasPrice {
+		wm.Log.Warningf("get contract price failed, use default price: %d, err: %v", MinContractGasPrice, err)
+		price = MinContractGasPrice
+	}
+
+	token.GasLimit = gasLimit
+	token.Price = price
+
+	return nil
 }
 
-//EstimateFeeRate 预估的没KB手续费率
+//EstimateFeeRate 预估的每KB手续费率
 func (wm *WalletManager) EstimateFeeRate() (decimal.Decimal, error) {
 
-	rate, _ := decimal.NewFromString("0.005")
+	rate, err := decimal.NewFromString(wm.Config.FeeRate)
+	if err != nil || rate.LessThan(decimal.Zero) {
+		return decimal.Zero, fmt.Errorf("invalid fee rate: %s", wm.Config.FeeRate)
+	}
 	return rate, nil
 }
 
-//EstimateFeeRate 预估的没KB手续费率
+//EstimateTokenFeeRate 预估合约调用的每KB手续费率，与普通交易一致
 func (wm *WalletManager) EstimateTokenFeeRate() (decimal.Decimal, error) {
-
-	rate, _ := decimal.NewFromString("0.007")
-	return rate, nil
+	return wm.EstimateFeeRate()
 }
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"sync"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//memPoolCache 已通知的交易池交易和已上链的交易，避免重复通知，交易上链后不再作为未确认交易通知
+type memPoolCache struct {
+	mu  sync.Mutex
+	txs map[string]bool //txid -> 是否已上链
+}
+
+func newMemPoolCache() *memPoolCache {
+	return &memPoolCache{txs: make(map[string]bool)}
+}
+
+//add 记录交易池交易，已存在时返回false
+func (c *memPoolCache) add(txid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.txs[txid]; ok {
+		return false
+	}
+	c.txs[txid] = false
+	return true
+}
+
+//confirm 记录已上链的交易
+func (c *memPoolCache) confirm(txid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.txs[txid] = true
+}
+
+//prune 移除已不在交易池中的记录，仍在交易池中的交易即使已上链也保留，避免节点交易池滞后时重复通知
+func (c *memPoolCache) prune(pending map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for txid := range c.txs {
+		if !pending[txid] {
+			delete(c.txs, txid)
+		}
+	}
+}
+
+//ScanTxMemPool 扫描交易池，通知未确认的交易，区块高度为0，扩展参数unconfirmed为true
+//交易上链后区块扫描会以相同的WxID和Sid再次通知，由观测者更新为已确认
+func (bs *NULSBlockScanner) ScanTxMemPool() {
+
+	txs, err := bs.wm.Api.GetUnconfirmedTxs()
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not get mempool transactions; unexpected error: %v", err)
+		return
+	}
+
+	pending := make(map[string]bool, len(txs))
+	for _, tx := range txs {
+		if tx != nil {
+			pending[tx.Hash] = true
+		}
+	}
+	bs.memPool.prune(pending)
+
+	for _, tx := range txs {
+		if tx == nil || len(tx.Hash) == 0 {
+			continue
+		}
+
+		//已通知或已上链的交易不重复通知
+		if !bs.memPool.add(tx.Hash) {
+			continue
+		}
+
+		result := bs.extractMemPoolTransaction(tx, bs.ScanTargetFunc)
+		if !result.Success {
+			bs.wm.Log.Std.Info("mempool transaction: %s extract failed.", tx.Hash)
+			continue
+		}
+
+		for o := range bs.Observers {
+			for key, data := range result.extractData {
+				if err := o.BlockExtractDataNotify(key, data); err != nil {
+					bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
+				}
+			}
+		}
+	}
+}
+
+//extractMemPoolTransaction 提取交易池交易的主币输入输出，合约执行结果上链后才能获取
+func (bs *NULSBlockScanner) extractMemPoolTransaction(tx *Tx, ScanTargetFunc openwallet.BlockScanTargetFunc) ExtractResult {
+
+	var (
+		result = ExtractResult{
+			TxID:                tx.Hash,
+			extractData:         make(map[string]*openwallet.TxExtractData),
+			extractContractData: make(map[string]*openwallet.TxExtractData),
+		}
+	)
+
+	tx.BlockHeight = 0
+	tx.ConfirmCount = 0
+	bs.extractTransaction(tx, "", &result, ScanTargetFunc)
+
+	for _, extractData := range result.extractData {
+		if extractData.Transaction != nil {
+			extractData.Transaction.Status = openwallet.TxStatusSuccess
+			extractData.Transaction.SetExtParam("unconfirmed", true)
+			extractData.Transaction.ConfirmTime = 0
+			extractData.Transaction.SubmitTime = tx.GetTime()
+		}
+	}
+
+	return result
+}
@@ -17,6 +17,7 @@ package nulsio2
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/blocktree/nulsio2-adapter/nulsio2_addrdec"
 	"github.com/blocktree/openwallet/v2/common"
@@ -153,9 +154,13 @@ type Tx struct {
 	Status       int       `json:"status"`
 	ConfirmCount int32     `json:"confirmCount"`
 	ScriptSig    string    `json:"scriptSig"`
+	Remark       string    `json:"remark"`
 }
 
 func (tx *Tx) GetTime() int64 {
+	if len(tx.Time) < 4 {
+		return 0
+	}
 	t, err := time.Parse("2006-01-02 15:04:05", tx.Time[:len(tx.Time)-4])
 	if err != nil {
 		return 0
@@ -164,6 +169,20 @@ func (tx *Tx) GetTime() int64 {
 	return timeNumber
 }
 
+//GetSigner 交易签名者，即第一个输入的地址
+func (tx *Tx) GetSigner() string {
+	if len(tx.Inputs) == 0 {
+		return ""
+	}
+	return tx.Inputs[0].Address
+}
+
+const (
+	//合约代币协议
+	Nrc20Protocol  = "nrc20"
+	Nrc721Protocol = "nrc721"
+)
+
 type NulsToken struct {
 	Hash            string `json:"-"`
 	ContractAddress string `json:"contractAddress"`
@@ -173,6 +192,90 @@ type NulsToken struct {
 	Name            string `json:"name"`
 	Symbol          string `json:"symbol"`
 	Decimals        int64  `json:"decimals"`
+	TokenId         string `json:"tokenId"` //NRC721的tokenId
+	Protocol        string `json:"-"`       //nrc20 或 nrc721
+}
+
+//IsNrc721 是否NRC721转账
+func (t *NulsToken) IsNrc721() bool {
+	return t.Protocol == Nrc721Protocol
+}
+
+//GetAmount 转账数量，NRC721每次转移一个token
+func (t *NulsToken) GetAmount() (decimal.Decimal, error) {
+	if t.IsNrc721() {
+		return decimal.New(1, 0), nil
+	}
+	return decimal.NewFromString(t.Value)
+}
+
+//ContractResult 合约调用的执行结果
+type ContractResult struct {
+	Hash              string              `json:"-"`
+	Success           bool                `json:"success"`
+	ErrorMessage      string              `json:"errorMessage"`
+	TokenTransfers    []*NulsToken        `json:"tokenTransfers"`
+	Token721Transfers []*NulsToken        `json:"token721Transfers"`
+	Transfers         []*ContractTransfer `json:"transfers"`
+	TotalFee          json.Number         `json:"totalFee"`          //gasLimit预付的手续费总额
+	TxSizeFee         json.Number         `json:"txSizeFee"`         //按交易大小收取的手续费
+	ActualContractFee json.Number         `json:"actualContractFee"` //实际消耗的gas费用
+	RefundFee         json.Number         `json:"refundFee"`         //退回的gas费用
+}
+
+//ActualFee 合约调用实际扣除的手续费，单位为最小单位，节点未返回手续费时ok为false
+func (r *ContractResult) ActualFee() (fee decimal.Decimal, ok bool) {
+	if len(r.TxSizeFee) > 0 && len(r.ActualContractFee) > 0 {
+		sizeFee, err := decimal.NewFromString(r.TxSizeFee.String())
+		if err != nil {
+			return decimal.Zero, false
+		}
+		contractFee, err := decimal.NewFromString(r.ActualContractFee.String())
+		if err != nil {
+			return decimal.Zero, false
+		}
+		return sizeFee.Add(contractFee), true
+	}
+
+	if len(r.TotalFee) > 0 {
+		totalFee, err := decimal.NewFromString(r.TotalFee.String())
+		if err != nil {
+			return decimal.Zero, false
+		}
+		refundFee := decimal.Zero
+		if len(r.RefundFee) > 0 {
+			refundFee, err = decimal.NewFromString(r.RefundFee.String())
+			if err != nil {
+				return decimal.Zero, false
+			}
+		}
+		return totalFee.Sub(refundFee), true
+	}
+
+	return decimal.Zero, false
+}
+
+//ContractTransfer 合约内部转出NULS，链上生成独立的合约转账交易
+type ContractTransfer struct {
+	TxHash      string                    `json:"txHash"`
+	From        string                    `json:"from"`
+	Value       string                    `json:"value"`
+	Outputs     []*ContractTransferOutput `json:"outputs"`
+	OrginTxHash string                    `json:"orginTxHash"`
+}
+
+//ContractTransferOutput 合约内部转账的接收方
+type ContractTransferOutput struct {
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+//GetTokenTransfers 合约调用产生的所有代币转账，NRC20在前，NRC721在后
+func (r *ContractResult) GetTokenTransfers() []*NulsToken {
+	tokens := make([]*NulsToken, 0, len(r.TokenTransfers)+len(r.Token721Transfers))
+	tokens = append(tokens, r.TokenTransfers...)
+	tokens = append(tokens, r.Token721Transfers...)
+	return tokens
 }
 
 type Output struct {
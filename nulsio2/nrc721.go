@@ -0,0 +1,115 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"strings"
+
+	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+const (
+	//NRC721转移方法
+	Nrc721MethodTransferFrom     = "transferFrom"
+	Nrc721MethodSafeTransferFrom = "safeTransferFrom"
+
+	//safeTransferFrom有重载方法，需要指定方法描述
+	nrc721SafeTransferFromDesc         = "(Address from, Address to, BigInteger tokenId) return void"
+	nrc721SafeTransferFromWithDataDesc = "(Address from, Address to, BigInteger tokenId, String data) return void"
+)
+
+//IsNrc721Contract 合约是否NRC721协议
+func IsNrc721Contract(contract openwallet.SmartContract) bool {
+	return strings.EqualFold(contract.Protocol, Nrc721Protocol)
+}
+
+//CreateNrc721RawTransaction 创建NRC721转移交易单
+//扩展参数：tokenId 转移的tokenId，nrc721Method 转移方法(safeTransferFrom/transferFrom，默认safeTransferFrom)，
+//data safeTransferFrom附带的数据(可选)，from token所有者(可选，默认查询ownerOf)，sender 指定调用地址(可选)
+//rawTx.To 只能有一个接收地址，数量忽略
+func (decoder *TransactionDecoder) CreateNrc721RawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		ext             = rawTx.GetExtParam()
+		contractAddress = rawTx.Coin.Contract.Address
+		tokenId         = ext.Get("tokenId").String()
+		method          = ext.Get("nrc721Method").String()
+		from            = ext.Get("from").String()
+		methodDesc      string
+		to              string
+		err             error
+	)
+
+	if len(tokenId) == 0 {
+		return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "tokenId of nrc721 can not be empty")
+	}
+
+	if len(rawTx.To) != 1 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "nrc721 only support one receiver")
+	}
+
+	for addr := range rawTx.To {
+		to = addr
+	}
+
+	args := []string{"", to, tokenId}
+	switch method {
+	case "", Nrc721MethodSafeTransferFrom:
+		method = Nrc721MethodSafeTransferFrom
+		methodDesc = nrc721SafeTransferFromDesc
+		if data := ext.Get("data"); data.Exists() {
+			methodDesc = nrc721SafeTransferFromWithDataDesc
+			args = append(args, data.String())
+		}
+	case Nrc721MethodTransferFrom:
+	default:
+		return openwallet.Errorf(openwallet.ErrContractCallMsgInvalid, "nrc721 method: %s is not supported", method)
+	}
+
+	//未指定所有者时查询tokenId的当前所有者
+	if len(from) == 0 {
+		from, err = decoder.wm.Api.GetNrc721OwnerOf(contractAddress, tokenId)
+		if err != nil {
+			return openwallet.Errorf(openwalletErrorCode(err, openwallet.ErrCallFullNodeAPIFailed), "get owner of token: %s failed, err: %v", tokenId, err)
+		}
+	}
+	args[0] = from
+
+	searchAddrs, err := decoder.getContractCallSenders(wrapper, rawTx)
+	if err != nil {
+		return err
+	}
+
+	//所有者属于账户时由所有者调用，否则由被授权的地址调用，未授权的地址预估gas会失败
+	for _, addr := range searchAddrs {
+		if addr == from {
+			searchAddrs = []string{from}
+			break
+		}
+	}
+
+	return decoder.createContractCallRawTransaction(wrapper, rawTx, searchAddrs, func(sender string) *nulsio2_trans.TxToken {
+		return &nulsio2_trans.TxToken{
+			Sender:          sender,
+			ContractAddress: contractAddress,
+			MethodName:      method,
+			MethodDesc:      methodDesc,
+			ArgsCount:       int64(len(args)),
+			Args:            args,
+		}
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+func TestCreateNrc721RawTransaction(t *testing.T) {
+	var (
+		owner    = testAddress(1)
+		receiver = testAddress(50)
+		contract = testAddress(90)
+	)
+
+	handlers := contractNodeHandlers(func(methodName string, args []gjson.Result) string {
+		if methodName != "ownerOf" || len(args) != 1 || args[0].String() != "7" {
+			return ""
+		}
+		return fmt.Sprintf(`{"result":"%s"}`, owner)
+	})
+	server := newTestNode(map[string]string{owner: "1000000000"}, handlers)
+	defer server.Close()
+
+	cases := []struct {
+		name   string
+		ext    string
+		method string
+		desc   string
+		args   string
+		code   uint64
+	}{
+		//默认使用safeTransferFrom，重载方法需要指定方法描述
+		{"default", `"tokenId":"7"`, Nrc721MethodSafeTransferFrom, nrc721SafeTransferFromDesc, "[[%s] [%s] [7]]", 0},
+		{"safeTransferFrom with data", `"tokenId":"7","nrc721Method":"safeTransferFrom","data":"hello"`, Nrc721MethodSafeTransferFrom, nrc721SafeTransferFromWithDataDesc, "[[%s] [%s] [7] [hello]]", 0},
+		//transferFrom不附带数据
+		{"transferFrom", `"tokenId":"7","nrc721Method":"transferFrom","data":"hello"`, Nrc721MethodTransferFrom, "", "[[%s] [%s] [7]]", 0},
+		{"unsupported method", `"tokenId":"7","nrc721Method":"approve"`, "", "", "", openwallet.ErrContractCallMsgInvalid},
+		{"empty tokenId", `"tokenId":""`, "", "", "", openwallet.ErrContractCallMsgInvalid},
+	}
+
+	for _, c := range cases {
+		decoder := newTestDecoder(server.URL)
+		rawTx := newTestRawTransaction(map[string]string{receiver: "1"})
+		rawTx.Coin = openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: contract, Protocol: Nrc721Protocol}}
+		rawTx.ExtParam = `{` + c.ext + `}`
+
+		err := decoder.CreateNrc721RawTransaction(&testWalletDAI{addresses: []string{owner}}, rawTx)
+		if c.code != 0 {
+			if errorCode(err) != c.code {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: CreateNrc721RawTransaction failed, unexpected error: %v", c.name, err)
+			continue
+		}
+
+		_, token := decodeTestTxToken(t, rawTx.RawHex)
+		if token.Sender != owner || token.MethodName != c.method || token.MethodDesc != c.desc {
+			t.Errorf("%s: unexpected method: %s, desc: %s", c.name, token.MethodName, token.MethodDesc)
+		}
+		if args := fmt.Sprint(token.MultiArgs); args != fmt.Sprintf(c.args, owner, receiver) {
+			t.Errorf("%s: unexpected args: %s", c.name, args)
+		}
+	}
+
+	//查询所有者失败时保留节点错误对应的错误码
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"success":false,"data":{"code":"lg_0004","msg":"balance not enough"}}`)
+	}))
+	defer failed.Close()
+
+	decoder := newTestDecoder(failed.URL)
+	rawTx := newTestRawTransaction(map[string]string{receiver: "1"})
+	rawTx.Coin = openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: contract, Protocol: Nrc721Protocol}}
+	rawTx.ExtParam = `{"tokenId":"7"}`
+	err := decoder.CreateNrc721RawTransaction(&testWalletDAI{addresses: []string{owner}}, rawTx)
+	if errorCode(err) != openwallet.ErrInsufficientBalanceOfAddress {
+		t.Errorf("unexpected error of ownerOf: %v", err)
+	}
+}
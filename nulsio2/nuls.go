@@ -17,11 +17,16 @@ package nulsio2
 
 import (
 	"errors"
+	"fmt"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/shopspring/decimal"
 	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 //CurveType 曲线类型
@@ -72,12 +77,123 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 
 	wm.Api.BaseURL = wm.Config.ServerAPI
 
+	wm.Config.ServerAPIs = c.String("serverAPIs")
+	if len(wm.Config.ServerAPIs) > 0 {
+		endpoints, err := ParseEndpoints(wm.Config.ServerAPIs)
+		if err != nil {
+			return err
+		}
+		wm.Api.SetEndpoints(endpoints)
+	}
+
+	if maxHeightLag, err := c.Int64("maxHeightLag"); err == nil && maxHeightLag > 0 {
+		wm.Api.MaxHeightLag = maxHeightLag
+	}
+
+	if healthCheckInterval, err := c.Int64("healthCheckInterval"); err == nil && healthCheckInterval > 0 {
+		wm.Api.HealthCheckInterval = time.Duration(healthCheckInterval) * time.Second
+	}
+
+	wm.Api.BroadcastAll, _ = c.Bool("broadcastAll")
+
+	if c.String("apiBackend") != "" {
+		wm.Config.APIBackend = strings.ToLower(c.String("apiBackend"))
+	}
+	if wm.Config.APIBackend != APIBackendREST && wm.Config.APIBackend != APIBackendJSONRPC {
+		return fmt.Errorf("invalid apiBackend: %s", wm.Config.APIBackend)
+	}
+	wm.Api.Backend = wm.Config.APIBackend
+
+	if c.String("chainId") != "" {
+		wm.Config.ChainId = c.String("chainId")
+	}
+	chainId, err := strconv.ParseInt(wm.Config.ChainId, 10, 64)
+	if err != nil || chainId <= 0 {
+		return fmt.Errorf("invalid chainId: %s", wm.Config.ChainId)
+	}
+	wm.Api.ChainId = chainId
+
+	if requestTimeout, err := c.Int64("requestTimeout"); err == nil && requestTimeout > 0 {
+		wm.Api.HTTPClient = &http.Client{Timeout: time.Duration(requestTimeout) * time.Second}
+	}
+
+	if requestRetries, err := c.Int("requestRetries"); err == nil && requestRetries >= 0 {
+		wm.Api.MaxRetries = requestRetries
+	}
+
+	if retryWaitMin, err := c.Int64("retryWaitMin"); err == nil && retryWaitMin > 0 {
+		wm.Api.RetryWaitMin = time.Duration(retryWaitMin) * time.Millisecond
+	}
+
+	if retryWaitMax, err := c.Int64("retryWaitMax"); err == nil && retryWaitMax > 0 {
+		wm.Api.RetryWaitMax = time.Duration(retryWaitMax) * time.Millisecond
+	}
+
+	//多节点时在后台定时检查节点健康状态
+	wm.Api.StartHealthCheck()
+
 	wm.Config.DataDir = c.String("dataDir")
 
 	if c.String("tokenFees") != "" {
 		wm.Config.TokenFees = c.String("tokenFees")
 	}
 
+	if c.String("feeRate") != "" {
+		wm.Config.FeeRate = c.String("feeRate")
+	}
+
+	if c.String("fixFees") != "" {
+		wm.Config.FixFees = c.String("fixFees")
+	}
+
+	if gasSafetyMargin, err := c.Float("gasSafetyMargin"); err == nil && gasSafetyMargin >= 1 {
+		wm.Config.GasSafetyMargin = gasSafetyMargin
+	}
+
+	wm.Config.MultiInputs, _ = c.Bool("multiInputs")
+
+	wm.Config.ScanMemPool, _ = c.Bool("scanMemPool")
+	if wm.Config.ScanMemPool && wm.Api.isJSONRPC() {
+		return fmt.Errorf("scanMemPool is not supported by jsonrpc backend, set scanMemPool = false or use apiBackend = \"rest\"")
+	}
+	wm.Blockscanner.IsScanMemPool = wm.Config.ScanMemPool
+
+	if catchUpConcurrency, err := c.Int("catchUpConcurrency"); err == nil && catchUpConcurrency > 0 {
+		wm.Config.CatchUpConcurrency = catchUpConcurrency
+	}
+
+	if catchUpWindow, err := c.Int("catchUpWindow"); err == nil && catchUpWindow > 0 {
+		wm.Config.CatchUpWindow = catchUpWindow
+	}
+
+	if catchUpTipDistance, err := c.Int64("catchUpTipDistance"); err == nil && catchUpTipDistance >= 0 {
+		wm.Config.CatchUpTipDistance = uint64(catchUpTipDistance)
+	}
+
+	if maxReorgDepth, err := c.Int64("maxReorgDepth"); err == nil && maxReorgDepth >= 0 {
+		wm.Config.MaxReorgDepth = uint64(maxReorgDepth)
+	}
+
+	if validateOnNode, err := c.Bool("validateOnNode"); err == nil {
+		wm.Config.ValidateOnNode = validateOnNode
+	}
+
+	if confirmations, err := c.Int64("confirmations"); err == nil && confirmations > 0 {
+		wm.Config.Confirmations = uint64(confirmations)
+	}
+
+	if c.String("assetConfirmations") != "" {
+		assetConfirmations, err := ParseAssetConfirmations(c.String("assetConfirmations"))
+		if err != nil {
+			return err
+		}
+		wm.Config.AssetConfirmations = assetConfirmations
+	}
+
+	if maxTxInputs, err := c.Int("maxTxInputs"); err == nil && maxTxInputs > 0 {
+		wm.Config.MaxTxInputs = maxTxInputs
+	}
+
 	//数据文件夹
 	wm.Config.makeDataDir()
 
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"strings"
+
+	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//CreateUnsignedTxPackage 导出离线签名包，包含原始交易单、每个输入的签名哈希、派生路径和金额
+func (decoder *TransactionDecoder) CreateUnsignedTxPackage(rawTx *openwallet.RawTransaction) (*nulsio2_trans.UnsignedTxPackage, error) {
+	if len(rawTx.RawHex) == 0 || !rawTx.IsBuilt {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction is not built")
+	}
+
+	keys := make(map[string]nulsio2_trans.SignerKey)
+	for _, keySignatures := range rawTx.Signatures {
+		for _, keySignature := range keySignatures {
+			if keySignature == nil || keySignature.Address == nil {
+				continue
+			}
+			keys[keySignature.Address.Address] = nulsio2_trans.SignerKey{
+				PublicKey:   keySignature.Address.PublicKey,
+				DerivedPath: keySignature.Address.HDPath,
+			}
+		}
+	}
+
+	pkg, err := nulsio2_trans.NewUnsignedTxPackage(rawTx.RawHex, keys)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
+	}
+
+	//签名消息必须与交易单哈希一致
+	for _, keySignatures := range rawTx.Signatures {
+		for _, keySignature := range keySignatures {
+			if keySignature != nil && len(keySignature.Message) > 0 && keySignature.Message != pkg.TxID {
+				return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "message to sign not match transaction hash: %s", pkg.TxID)
+			}
+		}
+	}
+
+	return pkg, nil
+}
+
+//ImportTxSignatures 导入离线签名结果，写入交易单的签名并装配为已签名的交易单，不访问节点
+func (decoder *TransactionDecoder) ImportTxSignatures(rawTx *openwallet.RawTransaction, signatures []*nulsio2_trans.TxSignature) error {
+	signedHex, err := nulsio2_trans.AssembleSignedTransaction(rawTx.RawHex, signatures)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "%v", err)
+	}
+
+	addrSignatures := make(map[string]*nulsio2_trans.TxSignature)
+	for _, s := range signatures {
+		if s != nil {
+			addrSignatures[s.Address] = s
+		}
+	}
+
+	for _, keySignatures := range rawTx.Signatures {
+		for _, keySignature := range keySignatures {
+			if keySignature == nil || keySignature.Address == nil {
+				continue
+			}
+			s, ok := addrSignatures[keySignature.Address.Address]
+			if !ok {
+				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "signature of address: %s is missing", keySignature.Address.Address)
+			}
+			if len(keySignature.Address.PublicKey) > 0 && !strings.EqualFold(keySignature.Address.PublicKey, s.PublicKey) {
+				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "public key of address: %s not match", keySignature.Address.Address)
+			}
+			keySignature.Signature = s.Signature
+		}
+	}
+
+	rawTx.IsCompleted = true
+	rawTx.RawHex = signedHex
+
+	return nil
+}
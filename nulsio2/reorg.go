@@ -0,0 +1,58 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+import (
+	"fmt"
+)
+
+//findForkAncestor 从分叉高度向前对比本地区块和节点区块的hash，查找共同祖先区块
+//返回共同祖先区块和已分叉的本地区块，分叉区块按高度从高到低排列
+//本地没有记录的高度无法对比，以节点区块作为共同祖先
+func (bs *NULSBlockScanner) findForkAncestor(forkHeight uint64) (*Block, []*Block, error) {
+
+	var (
+		forkBlocks = make([]*Block, 0)
+		maxDepth   = bs.wm.Config.MaxReorgDepth
+	)
+
+	for height := forkHeight; height > 0; height-- {
+
+		//超过最大回滚深度需要人工处理
+		if maxDepth > 0 && uint64(len(forkBlocks)) >= maxDepth {
+			return nil, nil, fmt.Errorf("fork depth from height: %d exceeds max reorg depth: %d", forkHeight, maxDepth)
+		}
+
+		nodeBlock, err := bs.wm.GetBlockHash(height)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can not get block on height: %d, err: %v", height, err)
+		}
+
+		localBlock, err := bs.GetLocalBlock(uint32(height))
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not get local block on height: %d, use the mainnet block as ancestor", height)
+			return nodeBlock.ToBlock(), forkBlocks, nil
+		}
+
+		if localBlock.Hash == nodeBlock.Hash {
+			return localBlock, forkBlocks, nil
+		}
+
+		forkBlocks = append(forkBlocks, localBlock)
+	}
+
+	return nil, nil, fmt.Errorf("can not find fork ancestor from height: %d", forkHeight)
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/imroc/req"
+)
+
+const (
+	//请求的默认超时时间
+	DefaultRequestTimeout = 30 * time.Second
+	//GET请求失败的默认重试次数
+	DefaultRequestRetries = 3
+	//重试的默认最短和最长等待时间
+	DefaultRetryWaitMin = 500 * time.Millisecond
+	DefaultRetryWaitMax = 5 * time.Second
+)
+
+//NewClient 创建节点API客户端
+func NewClient(baseURL string, debug bool) *Client {
+	return &Client{
+		BaseURL:      baseURL,
+		Debug:        debug,
+		HTTPClient:   &http.Client{Timeout: DefaultRequestTimeout},
+		MaxRetries:   DefaultRequestRetries,
+		RetryWaitMin: DefaultRetryWaitMin,
+		RetryWaitMax: DefaultRetryWaitMax,
+	}
+}
+
+//defaultHTTPClient 未设置HTTPClient时使用，带默认超时时间
+var defaultHTTPClient = &http.Client{Timeout: DefaultRequestTimeout}
+
+//httpClient 请求使用的http.Client
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return defaultHTTPClient
+	}
+	return c.HTTPClient
+}
+
+//retryBackoff 第attempt次重试前的等待时间，指数退避并加入随机抖动
+func (c *Client) retryBackoff(attempt int) time.Duration {
+	waitMin, waitMax := c.RetryWaitMin, c.RetryWaitMax
+	if waitMin <= 0 {
+		waitMin = DefaultRetryWaitMin
+	}
+	if waitMax < waitMin {
+		waitMax = waitMin
+	}
+
+	backoff := waitMin
+	for i := 0; i < attempt && backoff < waitMax; i++ {
+		backoff *= 2
+	}
+	if backoff > waitMax {
+		backoff = waitMax
+	}
+
+	//抖动范围为退避时间的一半
+	jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+	return backoff/2 + jitter
+}
+
+//shouldRetry 网络错误、限流和服务端错误可以重试
+func shouldRetry(r *req.Resp, err error) bool {
+	if err != nil {
+		return true
+	}
+	code := r.Response().StatusCode
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+//doRequest 向节点发送请求，节点请求失败时切换到下一个节点
+func (c *Client) doRequest(ctx context.Context, method, path string, retry bool, v ...interface{}) (*req.Resp, error) {
+
+	var lastErr error
+
+	urls := c.endpointURLs()
+	for i, url := range urls {
+		r, err := c.doRequestURL(ctx, method, url+path, retry, v...)
+		if err == nil {
+			if i > 0 {
+				log.Infof("request %s served by failover endpoint: %s", path, url)
+			} else if c.Debug {
+				log.Debugf("request %s served by endpoint: %s", path, url)
+			}
+			return r, nil
+		}
+
+		lastErr = err
+		if ctx != nil && ctx.Err() != nil {
+			break
+		}
+
+		if len(urls) > 1 {
+			log.Warningf("request %s to endpoint: %s failed, err: %v", path, url, err)
+			c.markEndpointFailed(url)
+		}
+	}
+
+	return nil, lastErr
+}
+
+//doRequestURL 发送请求，retry为true时按退避策略重试，只用于幂等的请求
+func (c *Client) doRequestURL(ctx context.Context, method, url string, retry bool, v ...interface{}) (*req.Resp, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	retries := 0
+	if retry {
+		retries = c.MaxRetries
+	}
+
+	args := append([]interface{}{c.httpClient(), ctx}, v...)
+
+	for attempt := 0; ; attempt++ {
+
+		if c.Debug {
+			log.Debug("Start Request API...")
+		}
+
+		r, err := req.Do(method, url, args...)
+
+		if c.Debug {
+			log.Debug("Request API Completed")
+		}
+
+		if !shouldRetry(r, err) {
+			return r, nil
+		}
+
+		if err == nil {
+			err = fmt.Errorf("request %s failed, status: %s", url, r.Response().Status)
+		}
+
+		if attempt >= retries || ctx.Err() != nil {
+			return nil, nodeUnavailable(err)
+		}
+
+		wait := c.retryBackoff(attempt)
+		log.Warningf("request %s failed, retry after %v, err: %v", url, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, nodeUnavailable(ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
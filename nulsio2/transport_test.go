@@ -0,0 +1,154 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//newTestClient 测试用的客户端，重试等待时间缩短为毫秒级
+func newTestClient(baseURL string) *Client {
+	client := NewClient(baseURL, false)
+	client.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+	client.RetryWaitMin = time.Millisecond
+	client.RetryWaitMax = 2 * time.Millisecond
+	return client
+}
+
+//newFlakyServer 前failures次请求返回status，之后返回body，calls记录请求次数
+func newFlakyServer(failures int32, status int, body string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+}
+
+func TestCallReq_Retry(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(2, http.StatusServiceUnavailable, `{"success":true,"data":{"height":100}}`, &calls)
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.MaxRetries = 3
+
+	result, err := client.CallReq("/api/block/newest")
+	if err != nil {
+		t.Fatalf("CallReq failed, unexpected error: %v", err)
+	}
+	if result.Get("height").Int() != 100 {
+		t.Errorf("unexpected result: %s", result.Raw)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected request count: %d", calls)
+	}
+}
+
+func TestCallReq_RetryExhausted(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(100, http.StatusInternalServerError, "", &calls)
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.MaxRetries = 2
+
+	_, err := client.CallReq("/api/block/newest")
+	if !IsRetryable(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected request count: %d", calls)
+	}
+}
+
+func TestCallReq_ClientErrorNotRetried(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(0, http.StatusOK, `{"success":false,"data":{"code":"tx_0012","msg":"tx not exist"}}`, &calls)
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.MaxRetries = 3
+
+	_, err := client.CallReq("/api/tx/abc")
+	if !IsNodeError(err, ErrNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected request count: %d", calls)
+	}
+}
+
+func TestCallPost_NotRetried(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(100, http.StatusServiceUnavailable, "", &calls)
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.MaxRetries = 3
+
+	if _, err := client.CallPost("/api/accountledger/transaction/broadcast", map[string]interface{}{"txHex": "00"}); err == nil {
+		t.Errorf("CallPost should fail")
+	}
+	if calls != 1 {
+		t.Errorf("non-idempotent request should not be retried, request count: %d", calls)
+	}
+}
+
+func TestCallReqContext_Canceled(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(100, http.StatusServiceUnavailable, "", &calls)
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.MaxRetries = 100
+	client.RetryWaitMin = time.Second
+	client.RetryWaitMax = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.CallReqContext(ctx, "/api/block/newest")
+	if !IsRetryable(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled request should return immediately, elapsed: %v", elapsed)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	client := &Client{RetryWaitMin: 100 * time.Millisecond, RetryWaitMax: 400 * time.Millisecond}
+
+	//退避时间按指数增长，不超过最长等待时间，抖动范围为一半
+	caps := []time.Duration{100, 200, 400, 400, 400}
+	for attempt, c := range caps {
+		c *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			wait := client.retryBackoff(attempt)
+			if wait < c/2 || wait > c {
+				t.Errorf("attempt %d: unexpected backoff: %v", attempt, wait)
+			}
+		}
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/blocktree/openwallet/v2/common"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
 	"math/big"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -33,7 +35,16 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
+	if isContractCallRawTransaction(rawTx) {
+		return decoder.CreateContractCallRawTransaction(wrapper, rawTx)
+	} else if rawTx.Coin.IsContract && IsAssetContract(rawTx.Coin.Contract) {
+		_, err := decoder.CreateSimpleRawAssetTransaction(wrapper, rawTx)
+		return err
+	} else if rawTx.Coin.IsContract && IsNrc721Contract(rawTx.Coin.Contract) {
+		return decoder.CreateNrc721RawTransaction(wrapper, rawTx)
+	} else if rawTx.Coin.IsContract && isNrc20MethodRawTransaction(rawTx) {
+		return decoder.CreateNrc20MethodRawTransaction(wrapper, rawTx)
+	} else if rawTx.Coin.IsContract {
 		return decoder.CreateSimpleRawNrc20Transaction(wrapper, rawTx)
 		//return openwallet.Errorf(openwallet.ErrUnknownException, "nrc20 not support in nuls2.0")
 	} else {
@@ -44,7 +55,11 @@ func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.Walle
 
 //CreateSummaryRawTransaction 创建汇总交易，返回原始交易单数组
 func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
-	if sumRawTx.Coin.IsContract {
+	if sumRawTx.Coin.IsContract && IsAssetContract(sumRawTx.Coin.Contract) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "asset summary not support in nuls2.0")
+	} else if sumRawTx.Coin.IsContract && IsNrc721Contract(sumRawTx.Coin.Contract) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "nrc721 summary not support in nuls2.0")
+	} else if sumRawTx.Coin.IsContract {
 		return decoder.CreateNrc20TokenSummaryRawTransaction(wrapper, sumRawTx)
 	} else {
 		return decoder.CreateSimpleSummaryRawTransaction(wrapper, sumRawTx)
@@ -71,9 +86,8 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 		return "", fmt.Errorf("[%s] have not addresses", accountID)
 	}
 
-	if len(rawTx.To) > 1 {
-		return "", openwallet.Errorf(openwallet.ErrUnknownException, "nrc20 not support many address in nuls2.0")
-
+	if len(rawTx.To) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver addresses is empty")
 	}
 
 	searchAddrs := make([]string, 0)
@@ -86,10 +100,10 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 		return "", err
 	}
 
-	var amountStr string
+	//所有接收地址的转账总数
+	amount := big.NewInt(0)
 	for _, v := range rawTx.To {
-		amountStr = v
-		break
+		amount.Add(amount, common.StringNumToBigIntWithExp(v, decimals))
 	}
 
 	//地址余额从大到小排序
@@ -103,9 +117,13 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 		}
 	})
 
-	amount := common.StringNumToBigIntWithExp(amountStr, decimals)
+	remark := getRawTransactionRemark(rawTx)
 
-	fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decimals)
+	//按交易单实际字节数计算手续费
+	fixFees, err = decoder.estimateFees(1, len(rawTx.To), 1, remark, 0)
+	if err != nil {
+		return "", err
+	}
 
 	for _, addrBalance := range addrBalanceArray {
 
@@ -127,6 +145,130 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 		break
 	}
 
+	findAddrBalances := make([]*AddrBalance, 0)
+	if findAddrBalance != nil {
+		findAddrBalances = append(findAddrBalances, findAddrBalance)
+	} else if decoder.wm.Config.MultiInputs {
+		//单个地址余额不足，合并多个地址作为输入，输入数量变化时重新计算手续费
+		for inputs := 1; ; {
+			fixFees, err = decoder.estimateFees(inputs, len(rawTx.To), inputs, remark, 0)
+			if err != nil {
+				return "", err
+			}
+			totalAmount := new(big.Int).Add(amount, fixFees)
+			findAddrBalances = selectMultiInputs(addrBalanceArray, totalAmount, decimals, decoder.wm.Config.MaxTxInputs)
+			if len(findAddrBalances) <= inputs {
+				break
+			}
+			inputs = len(findAddrBalances)
+		}
+	}
+
+	if len(findAddrBalances) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "all address's balance of account is not enough")
+	}
+
+	//最后创建交易单
+	hexStr, err := decoder.createSimpleRawTransaction(
+		wrapper,
+		rawTx,
+		findAddrBalances,
+		fixFees,
+		"", "")
+	if err != nil {
+		return "", err
+	}
+
+	return hexStr, nil
+}
+
+//CreateSimpleRawAssetTransaction 创建链上资产交易单，手续费使用主链资产支付
+func (decoder *TransactionDecoder) CreateSimpleRawAssetTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (string, error) {
+
+	var (
+		decimals        = decoder.wm.Decimal()
+		accountID       = rawTx.Account.AccountID
+		fixFees         = big.NewInt(0)
+		findAddrBalance *AddrBalance
+	)
+
+	asset, err := decoder.wm.getCoinAsset(rawTx.Coin)
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
+	}
+
+	//获取wallet
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(addresses) == 0 {
+		return "", fmt.Errorf("[%s] have not addresses", accountID)
+	}
+
+	if len(rawTx.To) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver addresses is empty")
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	addrBalanceMainArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return "", err
+	}
+
+	//所有接收地址的转账总数
+	amount := big.NewInt(0)
+	for _, v := range rawTx.To {
+		amount.Add(amount, common.StringNumToBigIntWithExp(v, asset.Decimals))
+	}
+
+	//资产输入和主链资产手续费输入，同一地址只签一次
+	fixFees, err = decoder.estimateFees(2, len(rawTx.To), 1, getRawTransactionRemark(rawTx), 0)
+	if err != nil {
+		return "", err
+	}
+
+	for _, addrBalance := range addrBalanceMainArray {
+
+		addrBalance_BI := common.StringNumToBigIntWithExp(addrBalance.Balance, decimals)
+
+		//主币余额不足支付手续费查找下一个地址
+		if addrBalance_BI.Cmp(fixFees) < 0 {
+			continue
+		}
+
+		assetBalance, err := decoder.wm.Api.GetAddressBalance(addrBalance.Address, asset.ChainId, asset.AssetId)
+		if err != nil {
+			//节点不可用时不能当作余额不足
+			if IsRetryable(err) {
+				return "", toOpenwalletError(err, openwallet.ErrCallFullNodeAPIFailed)
+			}
+			continue
+		}
+
+		assetBalance_BI, ok := new(big.Int).SetString(assetBalance.Available, 10)
+		if !ok {
+			continue
+		}
+
+		//资产余额不足查找下一个地址
+		if assetBalance_BI.Cmp(amount) < 0 {
+			continue
+		}
+
+		feesDecimal := common.BigIntToDecimals(fixFees, decimals)
+		amountDecimal := common.BigIntToDecimals(amount, asset.Decimals)
+
+		//只要找到一个合适使用的地址余额就停止遍历
+		findAddrBalance = &AddrBalance{Address: addrBalance.Address, Balance: &feesDecimal, TokenBalance: &amountDecimal}
+		break
+	}
+
 	if findAddrBalance == nil {
 		return "", openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "all address's balance of account is not enough")
 	}
@@ -135,7 +277,7 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 	hexStr, err := decoder.createSimpleRawTransaction(
 		wrapper,
 		rawTx,
-		findAddrBalance,
+		[]*AddrBalance{findAddrBalance},
 		fixFees,
 		"", "")
 	if err != nil {
@@ -199,7 +341,10 @@ func (decoder *TransactionDecoder) createSimpleRawTransactionForNrc20Main(wrappe
 
 	amount := common.StringNumToBigIntWithExp(amountStr, decimals)
 
-	fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decimals)
+	fixFees, err = decoder.estimateFees(1, len(rawTx.To), 1, getRawTransactionRemark(rawTx), 0)
+	if err != nil {
+		return "", err
+	}
 
 	for _, addrBalance := range addrBalanceArray {
 
@@ -229,7 +374,7 @@ func (decoder *TransactionDecoder) createSimpleRawTransactionForNrc20Main(wrappe
 	hexStr, err := decoder.createSimpleRawTransaction(
 		wrapper,
 		rawTx,
-		findAddrBalance,
+		[]*AddrBalance{findAddrBalance},
 		fixFees,
 		"", nonce)
 	if err != nil {
@@ -249,7 +394,6 @@ func (decoder *TransactionDecoder) CreateSimpleRawNrc20Transaction(wrapper openw
 		findAddrBalance *AddrBalance
 		tokenAddress    string
 		tokenDecimal    uint64
-		sendAddress     string
 		to              string
 		totalSend       = decimal.New(0, 0)
 	)
@@ -308,24 +452,18 @@ func (decoder *TransactionDecoder) CreateSimpleRawNrc20Transaction(wrapper openw
 
 	amount := common.StringNumToBigIntWithExp(amountStr, int32(tokenDecimal))
 
-	fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.TokenFees, decimals)
+	var token *nulsio2_trans.TxToken
 
 	for _, addrBalance := range addrBalanceMainArray {
 
 		addrBalance_BI := common.StringNumToBigIntWithExp(addrBalance.Balance, decimals)
 
-		//总消耗数量 = 转账数量 + 手续费
-		//totalAmount := new(big.Int)
-		//totalAmount.Add(amount, fixFees)
-
-		//主币余额不足查找下一个地址
-		if addrBalance_BI.Cmp(fixFees) < 0 {
-			continue
-		}
-		addrBalanceMainDecimal := common.BigIntToDecimals(fixFees, decimals)
-
 		tokenBalance, err := decoder.wm.Api.GetTokenBalances(tokenAddress, addrBalance.Address)
 		if err != nil {
+			//节点不可用时不能当作余额不足
+			if IsRetryable(err) {
+				return toOpenwalletError(err, openwallet.ErrCallFullNodeAPIFailed)
+			}
 			continue
 		}
 
@@ -336,9 +474,28 @@ func (decoder *TransactionDecoder) CreateSimpleRawNrc20Transaction(wrapper openw
 			continue
 		}
 
+		//按发送地址预估gas，手续费 = gasLimit * price + 字节数手续费
+		addrToken, err := decoder.newNrc20TransferToken(addrBalance.Address, tokenAddress, to, totalSend.Shift(int32(tokenDecimal)).String())
+		if err != nil {
+			decoder.wm.Log.Errorf("address: %s estimate gas failed, err: %v", addrBalance.Address, err)
+			continue
+		}
+
+		addrFees, err := decoder.estimateTokenFees(addrToken, getRawTransactionRemark(rawTx))
+		if err != nil {
+			return err
+		}
+
+		//主币余额不足查找下一个地址
+		if addrBalance_BI.Cmp(addrFees) < 0 {
+			continue
+		}
+		addrBalanceMainDecimal := common.BigIntToDecimals(addrFees, decimals)
+
 		//只要找到一个合适使用的地址余额就停止遍历
 		findAddrBalance = &AddrBalance{Address: addrBalance.Address, Balance: &addrBalanceMainDecimal, TokenBalance: &tokenBalance}
-		sendAddress = addrBalance.Address
+		fixFees = addrFees
+		token = addrToken
 		break
 	}
 
@@ -346,16 +503,6 @@ func (decoder *TransactionDecoder) CreateSimpleRawNrc20Transaction(wrapper openw
 		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "all address's balance of account is not enough")
 	}
 
-	token := &nulsio2_trans.TxToken{
-		Sender:          sendAddress,
-		ContractAddress: tokenAddress,
-		Value:           0,
-		GasLimit:        35000,
-		Price:           25,
-		MethodName:      "transfer",
-		ArgsCount:       2,
-		Args:            []string{to, totalSend.Shift(int32(tokenDecimal)).String()},
-	}
 	//最后创建交易单
 	errE := decoder.createSimpleNrc20RawTransaction(
 		wrapper,
@@ -364,7 +511,7 @@ func (decoder *TransactionDecoder) CreateSimpleRawNrc20Transaction(wrapper openw
 		fixFees,
 		"", token)
 	if errE != nil {
-		return err
+		return errE
 	}
 
 	return nil
@@ -380,7 +527,7 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 		minTransfer     = common.StringNumToBigIntWithExp(sumRawTx.MinTransfer, decimals)
 		retainedBalance = common.StringNumToBigIntWithExp(sumRawTx.RetainedBalance, decimals)
 		fixFees         = big.NewInt(0)
-		feeInfo         *big.Int
+		feeRate         decimal.Decimal
 		//nonce string
 	)
 
@@ -405,13 +552,26 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 	}
 
 	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return nil, err
+	}
 
+	//汇总交易指定的是每KB手续费率
 	if len(sumRawTx.FeeRate) > 0 {
-		fixFees = common.StringNumToBigIntWithExp(sumRawTx.FeeRate, decimals)
+		feeRate, err = decimal.NewFromString(sumRawTx.FeeRate)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid fee rate: %s", sumRawTx.FeeRate)
+		}
 	} else {
-		fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decimals)
+		feeRate, err = decoder.wm.EstimateFeeRate()
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	fees := decoder.wm.EstimateTxFee(1, 1, 1, getSummaryRemark(sumRawTx), 0, feeRate)
+	fixFees = common.StringNumToBigIntWithExp(fees.String(), decimals)
+
 	for _, addrBalance := range addrBalanceArray {
 
 		//检查余额是否超过最低转账
@@ -445,15 +605,17 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 				sumRawTx.SummaryAddress: sumAmount.StringFixed(decoder.wm.Decimal()),
 			},
 			Required: 1,
+			ExtParam: sumRawTx.ExtParam,
 		}
 
-		aaddrBalanceDecimal := common.BigIntToDecimals(addrBalance_BI, decimals)
+		//输入数量 = 汇总数量 + 手续费，保留余额留在地址
+		inputAmount := sumAmount.Add(feesAmount)
 
 		_, createErr := decoder.createSimpleRawTransaction(
 			wrapper,
 			rawTx,
-			&AddrBalance{Address: addrBalance.Address, Balance: &aaddrBalanceDecimal},
-			feeInfo,
+			[]*AddrBalance{{Address: addrBalance.Address, Balance: &inputAmount}},
+			fixFees,
 			"", "")
 		if createErr != nil {
 			return nil, createErr
@@ -561,7 +723,23 @@ func (this *TransactionDecoder) CreateNrc20TokenSummaryRawTransaction(wrapper op
 		sumAmount_BI.Sub(addrBalance_BI, retainedBalance)
 
 		sumAmount := common.BigIntToDecimals(sumAmount_BI, int32(tokenDecimals))
-		fees, _ := decimal.NewFromString(this.wm.Config.TokenFees)
+
+		token, tokenErr := this.newNrc20TransferToken(addrBalance.Balance.Address, contractAddress, sumRawTx.SummaryAddress, sumAmount_BI.String())
+		if tokenErr != nil {
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: &openwallet.RawTransaction{
+					Coin:    sumRawTx.Coin,
+					Account: sumRawTx.Account,
+				},
+				Error: openwallet.ConvertError(tokenErr),
+			})
+			continue
+		}
+		fixFees, feesErr := this.estimateTokenFees(token, getSummaryRemark(sumRawTx))
+		if feesErr != nil {
+			return nil, feesErr
+		}
+		fees := common.BigIntToDecimals(fixFees, this.wm.Decimal())
 
 		coinBalances, createErr := this.wm.Blockscanner.GetBalanceByAddress(addrBalance.Balance.Address)
 		if createErr != nil {
@@ -648,18 +826,8 @@ func (this *TransactionDecoder) CreateNrc20TokenSummaryRawTransaction(wrapper op
 				sumRawTx.SummaryAddress: sumAmount.StringFixed(int32(tokenDecimals)),
 			},
 			Required: 1,
+			ExtParam: sumRawTx.ExtParam,
 		}
-		token := &nulsio2_trans.TxToken{
-			Sender:          addrBalance.Balance.Address,
-			ContractAddress: contractAddress,
-			Value:           0,
-			GasLimit:        35000,
-			Price:           25,
-			MethodName:      "transfer",
-			ArgsCount:       2,
-			Args:            []string{sumRawTx.SummaryAddress, sumAmount_BI.String()},
-		}
-		fixFees := common.StringNumToBigIntWithExp(this.wm.Config.TokenFees, this.wm.Decimal())
 		//最后创建交易单
 		createTxErr := this.createSimpleNrc20RawTransaction(
 			wrapper,
@@ -722,57 +890,43 @@ func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletD
 //VerifyRawTransaction 验证交易单，验证交易单并返回加入签名后的交易单
 func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
-	rawHex, err := hex.DecodeString(rawTx.RawHex)
-	if err != nil {
-		return err
-	}
-
 	if rawTx.Signatures == nil || len(rawTx.Signatures) == 0 {
 		//this.wm.Log.Std.Error("len of signatures error. ")
 		return fmt.Errorf("transaction signature is empty")
 	}
 
-	sigPubByte := make([]byte, 0)
-
+	//按地址汇总签名
+	signatures := make([]*nulsio2_trans.TxSignature, 0)
 	for accountID, keySignatures := range rawTx.Signatures {
 		decoder.wm.Log.Debug("accountID Signatures:", accountID)
 		for _, keySignature := range keySignatures {
-
-			signature, _ := hex.DecodeString(keySignature.Signature)
-			pub, _ := hex.DecodeString(keySignature.Address.PublicKey)
-			//pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
-
-			sigPub := &nulsio2_trans.SigPub{
-				pub,
-				signature,
+			if keySignature == nil || keySignature.Address == nil {
+				continue
 			}
-
-			result := make([]byte, 0)
-			result = append(result, byte(len(pub)))
-			result = append(result, pub...)
-
-			//result = append(result, 0)
-			resultSig := make([]byte, 0)
-			resultSig = append(resultSig, sigPub.ToBytes()...)
-
-			result = append(result, resultSig...)
-
-			sigPubByte = append(sigPubByte, result...)
+			signatures = append(signatures, &nulsio2_trans.TxSignature{
+				Address:   keySignature.Address.Address,
+				PublicKey: keySignature.Address.PublicKey,
+				Signature: keySignature.Signature,
+			})
 		}
 	}
 
-	sigPubByte, _ = nulsio2_trans.GetBytesWithLength(sigPubByte)
-
-	rawBytes := make([]byte, 0)
-	rawBytes = append(rawBytes, rawHex...)
-	//rawBytes = rawBytes[:len(rawBytes)-1]
-	rawBytes = append(rawBytes, sigPubByte...)
+	//按输入地址顺序装配签名，每个输入地址只签一次
+	signedHex, err := nulsio2_trans.AssembleSignedTransaction(rawTx.RawHex, signatures)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "%v", err)
+	}
 	rawTx.IsCompleted = true
-	rawTx.RawHex = hex.EncodeToString(rawBytes)
+	rawTx.RawHex = signedHex
+
+	//离线环境不访问节点
+	if !decoder.wm.Config.ValidateOnNode {
+		return nil
+	}
 
 	_, err = decoder.wm.Api.VaildTransaction(rawTx.RawHex)
 	if err != nil {
-		return err
+		return toOpenwalletError(err, openwallet.ErrVerifyRawTransactionFailed)
 	}
 
 	return nil
@@ -795,10 +949,24 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		return nil, fmt.Errorf("transaction is not completed validation")
 	}
 
-	txId, err := decoder.wm.Api.SendRawTransaction(rawTx.RawHex)
+	//广播前计算txid，重复广播时用于确认交易是否已被节点接收
+	txId, err := nulsio2_trans.CalcTxHash(rawTx.RawHex)
 	if err != nil {
 		return nil, err
 	}
+
+	nodeTxId, err := decoder.wm.Api.SendRawTransaction(rawTx.RawHex)
+	if err != nil {
+		//节点已存在该交易，视为广播成功
+		if !IsNodeError(err, ErrTxExists) {
+			if _, getErr := decoder.wm.Api.GetTxByTxId(txId); getErr != nil {
+				return nil, toOpenwalletError(err, openwallet.ErrSubmitRawTransactionFailed)
+			}
+		}
+		decoder.wm.Log.Warningf("transaction: %s has been broadcast before, err: %v", txId, err)
+	} else if len(nodeTxId) > 0 && nodeTxId != txId {
+		decoder.wm.Log.Warningf("transaction hash mismatch, local: %s, node: %s", txId, nodeTxId)
+	}
 	rawTx.TxID = txId
 
 	decimals := int32(0)
@@ -839,7 +1007,7 @@ func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, u
 func (decoder *TransactionDecoder) createSimpleRawTransaction(
 	wrapper openwallet.WalletDAI,
 	rawTx *openwallet.RawTransaction,
-	addrBalance *AddrBalance,
+	addrBalances []*AddrBalance,
 	feeInfo *big.Int,
 	callData, nonce string) (string, error) {
 
@@ -848,54 +1016,98 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 		vins             = make([]nulsio2_trans.Vin, 0)
 		vouts            = make([]nulsio2_trans.Vout, 0)
 		accountTotalSent = decimal.Zero
+		totalFees        = decimal.Zero
 		txFrom           = make([]string, 0)
 		txTo             = make([]string, 0)
 	)
 
-	if addrBalance == nil {
+	if len(addrBalances) == 0 {
 		return "", fmt.Errorf("Receiver addresses is empty! ")
 	}
 
-	fromAddress, err := decoder.wm.Api.GetAddressBalance(addrBalance.Address, 1)
+	if decoder.wm.Config.MaxTxInputs > 0 && len(addrBalances) > decoder.wm.Config.MaxTxInputs {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "inputs of transaction over the limit: %d", decoder.wm.Config.MaxTxInputs)
+	}
+
+	asset, err := decoder.wm.getCoinAsset(rawTx.Coin)
 	if err != nil {
-		return "", openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "can't find the address:"+err.Error())
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
 	}
-	//fromAddress.Nonce = "0000000000000000"
-	if nonce != "" {
-		fromAddress.Nonce = nonce
+
+	for i, addrBalance := range addrBalances {
+
+		fromAddress, err := decoder.wm.Api.GetAddressBalance(addrBalance.Address, MainAssetChainId, MainAssetId)
+		if err != nil {
+			return "", openwallet.Errorf(openwalletErrorCode(err, openwallet.ErrInsufficientBalanceOfAddress), "can't find the address:"+err.Error())
+		}
+		//fromAddress.Nonce = "0000000000000000"
+		//指定的nonce只用于第一个输入地址
+		if nonce != "" && i == 0 {
+			fromAddress.Nonce = nonce
+		}
+
+		if !asset.IsMainAsset() {
+			if addrBalance.TokenBalance == nil {
+				return "", openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "asset balance of address is empty")
+			}
+
+			assetAddress, err := decoder.wm.Api.GetAddressBalance(addrBalance.Address, asset.ChainId, asset.AssetId)
+			if err != nil {
+				return "", openwallet.Errorf(openwalletErrorCode(err, openwallet.ErrInsufficientBalanceOfAddress), "can't find the address:"+err.Error())
+			}
+
+			//装配资产输入
+			assetIn := nulsio2_trans.Vin{
+				Address:       addrBalance.Address,
+				Nonce:         assetAddress.Nonce,
+				AssetsChainId: uint64(asset.ChainId),
+				AssetsId:      uint64(asset.AssetId),
+				Amount:        decimalToBigInt(*addrBalance.TokenBalance, asset.Decimals),
+			}
+			vins = append(vins, assetIn)
+			txFrom = append(txFrom, fmt.Sprintf("%s:%s", addrBalance.Address, addrBalance.TokenBalance.String()))
+
+			totalFees = totalFees.Add(*addrBalance.Balance)
+		}
+
+		//装配输入，手续费始终使用主链资产支付
+		in := nulsio2_trans.Vin{
+			Address:       addrBalance.Address,
+			Nonce:         fromAddress.Nonce,
+			AssetsChainId: uint64(MainAssetChainId),
+			AssetsId:      uint64(MainAssetId),
+			Amount:        decimalToBigInt(*addrBalance.Balance, decoder.wm.Decimal()),
+		}
+		vins = append(vins, in)
+		if asset.IsMainAsset() {
+			txFrom = append(txFrom, fmt.Sprintf("%s:%s", addrBalance.Address, addrBalance.Balance.String()))
+		}
 	}
 
-	//装配输入
-	in := nulsio2_trans.Vin{
-		Address:       addrBalance.Address,
-		Nonce:         fromAddress.Nonce,
-		AssetsChainId: 1,
-		AssetsId:      1,
-		Amount:        uint64(addrBalance.Balance.Shift(decoder.wm.Decimal()).IntPart()),
+	//输出锁定时间
+	outputLockTime, err := getRawTransactionLockTime(rawTx)
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
 	}
-	vins = append(vins, in)
-	txFrom = append(txFrom, fmt.Sprintf("%s:%s", addrBalance.Address, addrBalance.Balance.String()))
 
-	//装配输入
-	for toAddress, amount := range rawTx.To {
+	//装配输出，按地址排序保证输出顺序固定
+	for _, toAddress := range sortedRecipients(rawTx.To) {
 
-		amountDecimal, _ := decimal.NewFromString(amount)
+		amount := rawTx.To[toAddress]
+		amountDecimal, err := decimal.NewFromString(amount)
+		if err != nil || !amountDecimal.GreaterThan(decimal.Zero) {
+			return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s of address: %s", amount, toAddress)
+		}
 
 		//累加
 		accountTotalSent = accountTotalSent.Add(amountDecimal)
 
-		amountDecimal = amountDecimal.Shift(decoder.wm.Decimal())
-
-		to, err := decoder.wm.Api.GetAddressBalance(toAddress, 1)
-		if err != nil {
-			return "", openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "can't find the address:"+err.Error())
-		}
 		out := nulsio2_trans.Vout{
 			Address:       toAddress,
-			Nonce:         to.Nonce,
-			AssetsChainId: 1,
-			AssetsId:      1,
-			Amount:        uint64(amountDecimal.IntPart()),
+			AssetsChainId: uint64(asset.ChainId),
+			AssetsId:      uint64(asset.AssetId),
+			Amount:        decimalToBigInt(amountDecimal, asset.Decimals),
+			LockTime:      uint64(outputLockTime),
 		}
 		vouts = append(vouts, out)
 
@@ -908,11 +1120,15 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 	//追加手续费支持
 	replaceable := false
 
+	//交易备注
+	//备注由CreateEmptyRawTransaction校验
+	remark := getRawTransactionRemark(rawTx)
+
 	/////////构建空交易单
-	signTrans, _, err := nulsio2_trans.CreateEmptyRawTransaction(vins, vouts, "", lockTime, replaceable, nil)
+	signTrans, _, err := nulsio2_trans.CreateEmptyRawTransaction(vins, vouts, remark, lockTime, replaceable, nil)
 
 	if err != nil {
-		return "", fmt.Errorf("create transaction failed, unexpected error: %v", err)
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create transaction failed, unexpected error: %v", err)
 	}
 
 	rawTx.RawHex = signTrans
@@ -921,41 +1137,51 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
 	}
 
-	//装配签名
-	keySigs := make([]*openwallet.KeySignature, 0)
-
-	addr, err := wrapper.GetAddress(addrBalance.Address)
+	//交易单哈希即被签消息，也是广播后的txid
+	messageStr, err := nulsio2_trans.CalcTxHash(signTrans)
 	if err != nil {
 		return "", err
 	}
 
-	beSignHexHex, err := hex.DecodeString(signTrans)
-	if err != nil {
-		return "", err
-	}
+	//装配签名，每个输入地址一个签名
+	keySigs := make([]*openwallet.KeySignature, 0)
 
-	message := nulsio2_trans.Sha256Twice(beSignHexHex) //sha256
+	for _, addrBalance := range addrBalances {
+		addr, err := wrapper.GetAddress(addrBalance.Address)
+		if err != nil {
+			return "", err
+		}
 
-	messageStr := hex.EncodeToString(message)
+		signature := openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: addr,
+			Message: messageStr,
+		}
 
-	signature := openwallet.KeySignature{
-		EccType: decoder.wm.Config.CurveType,
-		Nonce:   "",
-		Address: addr,
-		Message: messageStr,
+		keySigs = append(keySigs, &signature)
 	}
 
-	keySigs = append(keySigs, &signature)
-
-	rawTx.Fees = "0.001" //默认手续费
+	if asset.IsMainAsset() {
+		//手续费 = 输入总数 - 输出总数
+		totalInputs := decimal.Zero
+		for _, addrBalance := range addrBalances {
+			totalInputs = totalInputs.Add(*addrBalance.Balance)
+		}
+		feesDec := totalInputs.Sub(accountTotalSent)
+		rawTx.Fees = feesDec.StringFixed(decoder.wm.Decimal())
 
-	feesDec, _ := decimal.NewFromString(rawTx.Fees)
-	accountTotalSent = accountTotalSent.Add(feesDec)
+		accountTotalSent = accountTotalSent.Add(feesDec)
+	} else {
+		//链上资产交易的手续费为主链资产输入
+		rawTx.Fees = totalFees.String()
+	}
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
 	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	rawTx.TxID = messageStr
 	rawTx.IsBuilt = true
-	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.wm.Decimal())
+	rawTx.TxAmount = accountTotalSent.StringFixed(asset.Decimals)
 	rawTx.TxFrom = txFrom
 	rawTx.TxTo = txTo
 
@@ -984,30 +1210,50 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 		return openwallet.Errorf(openwallet.ErrUnknownException, "Receiver addresses is empty! ")
 	}
 
-	fromAddress, err := decoder.wm.Api.GetAddressBalance(addrBalance.Address, 1)
+	fromAddress, err := decoder.wm.Api.GetAddressBalance(addrBalance.Address, MainAssetChainId, MainAssetId)
 	if err != nil {
-		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "can't find the address:"+err.Error())
+		return openwallet.Errorf(openwalletErrorCode(err, openwallet.ErrInsufficientBalanceOfAddress), "can't find the address:"+err.Error())
 	}
 
-	feeDe, _ := decimal.NewFromString(decoder.wm.Config.TokenFees)
-	if feeDe.Equal(decimal.Zero) {
-		feeDe, _ = decimal.NewFromString("0.01")
+	if feeInfo == nil || feeInfo.Sign() <= 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "fees of contract call is empty")
 	}
-	//装配输入(直接使用手续费)
+	feeDe := common.BigIntToDecimals(feeInfo, decoder.wm.Decimal())
+
+	//payable合约调用附带的主币数量
+	valueDe := common.BigIntToDecimals(token.Value, decoder.wm.Decimal())
+
+	//装配输入(手续费 + 附带的主币)
 	in := nulsio2_trans.Vin{
 		Address:       addrBalance.Address,
 		Nonce:         fromAddress.Nonce,
-		AssetsChainId: 1,
-		AssetsId:      1,
-		Amount:        uint64(feeDe.Shift(decoder.wm.Decimal()).IntPart()),
+		AssetsChainId: uint64(MainAssetChainId),
+		AssetsId:      uint64(MainAssetId),
+		Amount:        decimalToBigInt(feeDe.Add(valueDe), decoder.wm.Decimal()),
 	}
 	vins = append(vins, in)
-	txFrom = append(txFrom, fmt.Sprintf("%s:%s", addrBalance.Address, addrBalance.TokenBalance.String()))
+	if addrBalance.TokenBalance != nil {
+		txFrom = append(txFrom, fmt.Sprintf("%s:%s", addrBalance.Address, addrBalance.TokenBalance.String()))
+	} else {
+		txFrom = append(txFrom, fmt.Sprintf("%s:%s", addrBalance.Address, feeDe.Add(valueDe).String()))
+	}
+
+	//附带的主币转入合约地址
+	if token.Value != nil && token.Value.Sign() > 0 {
+		vouts = append(vouts, nulsio2_trans.Vout{
+			Address:       token.ContractAddress,
+			AssetsChainId: uint64(MainAssetChainId),
+			AssetsId:      uint64(MainAssetId),
+			Amount:        token.Value,
+		})
+		txTo = append(txTo, fmt.Sprintf("%s:%s", token.ContractAddress, valueDe.String()))
+		accountTotalSent = accountTotalSent.Add(valueDe)
+	}
 
 	//装配输出
 	for toAddress, amount := range rawTx.To {
 
-		//to, err := decoder.wm.Api.GetAddressBalance(toAddress, 1)
+		//to, err := decoder.wm.Api.GetAddressBalance(toAddress, MainAssetChainId, MainAssetId)
 		//if err != nil {
 		//	return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "can't find the address:"+err.Error())
 		//}
@@ -1029,11 +1275,15 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 	//追加手续费支持
 	replaceable := false
 
+	//交易备注
+	//备注由CreateEmptyRawTransaction校验
+	remark := getRawTransactionRemark(rawTx)
+
 	/////////构建空交易单
-	signTrans, _, err := nulsio2_trans.CreateEmptyRawTransaction(vins, vouts, "", lockTime, replaceable, token)
+	signTrans, _, err := nulsio2_trans.CreateEmptyRawTransaction(vins, vouts, remark, lockTime, replaceable, token)
 
 	if err != nil {
-		return openwallet.Errorf(openwallet.ErrUnknownException, "create transaction failed, unexpected error: %v"+err.Error())
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create transaction failed, unexpected error: %v", err)
 	}
 
 	rawTx.RawHex = signTrans
@@ -1050,15 +1300,12 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 		return openwallet.Errorf(openwallet.ErrUnknownException, err.Error())
 	}
 
-	beSignHexHex, err := hex.DecodeString(signTrans)
+	//交易单哈希即被签消息，也是广播后的txid
+	messageStr, err := nulsio2_trans.CalcTxHash(signTrans)
 	if err != nil {
 		return openwallet.Errorf(openwallet.ErrUnknownException, err.Error())
 	}
 
-	message := nulsio2_trans.Sha256Twice(beSignHexHex) //sha256
-
-	messageStr := hex.EncodeToString(message)
-
 	signature := openwallet.KeySignature{
 		EccType: decoder.wm.Config.CurveType,
 		Nonce:   "",
@@ -1068,12 +1315,12 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 
 	keySigs = append(keySigs, &signature)
 
-	rawTx.Fees = decoder.wm.Config.TokenFees //默认手续费
+	rawTx.Fees = feeDe.StringFixed(decoder.wm.Decimal())
 
-	feesDec, _ := decimal.NewFromString(rawTx.Fees)
-	accountTotalSent = accountTotalSent.Add(feesDec)
+	accountTotalSent = accountTotalSent.Add(feeDe)
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	rawTx.TxID = messageStr
 	rawTx.IsBuilt = true
 	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.wm.Decimal())
 	rawTx.TxFrom = txFrom
@@ -1081,6 +1328,136 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 	return nil
 }
 
+//newNrc20TransferToken 创建NRC20转账的合约调用数据，gasLimit和gas单价由节点预估
+func (decoder *TransactionDecoder) newNrc20TransferToken(sender, contractAddress, to, amount string) (*nulsio2_trans.TxToken, error) {
+	token := &nulsio2_trans.TxToken{
+		Sender:          sender,
+		ContractAddress: contractAddress,
+		Value:           big.NewInt(0),
+		MethodName:      "transfer",
+		ArgsCount:       2,
+		Args:            []string{to, amount},
+	}
+	if err := decoder.wm.EstimateContractGas(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+//estimateFees 使用手续费引擎计算交易手续费（最小单位）
+func (decoder *TransactionDecoder) estimateFees(inputs, outputs, signers int, remark string, txDataLen int) (*big.Int, error) {
+	feeRate, err := decoder.wm.EstimateFeeRate()
+	if err != nil {
+		return nil, err
+	}
+	fees := decoder.wm.EstimateTxFee(inputs, outputs, signers, remark, txDataLen, feeRate)
+	return common.StringNumToBigIntWithExp(fees.String(), decoder.wm.Decimal()), nil
+}
+
+//estimateTokenFees 使用手续费引擎计算合约调用手续费（最小单位）
+func (decoder *TransactionDecoder) estimateTokenFees(token *nulsio2_trans.TxToken, remark string) (*big.Int, error) {
+	feeRate, err := decoder.wm.EstimateTokenFeeRate()
+	if err != nil {
+		return nil, err
+	}
+	fees := decoder.wm.EstimateTokenFee(token, remark, feeRate)
+	return common.StringNumToBigIntWithExp(fees.String(), decoder.wm.Decimal()), nil
+}
+
+//decimalToBigInt 将金额按精度转为最小单位的整数，超出精度的部分截断
+func decimalToBigInt(amount decimal.Decimal, decimals int32) *big.Int {
+	return common.StringNumToBigIntWithExp(amount.Shift(decimals).Truncate(0).String(), 0)
+}
+
+//sortedRecipients 按地址排序的接收地址列表
+func sortedRecipients(to map[string]string) []string {
+	addrs := make([]string, 0, len(to))
+	for addr := range to {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+//selectMultiInputs 按余额从大到小合并多个地址，直到满足总消耗数量，最后一个地址只使用不足的部分
+func selectMultiInputs(addrBalanceArray []*openwallet.Balance, totalAmount *big.Int, decimals int32, maxInputs int) []*AddrBalance {
+
+	sorted := make([]*openwallet.Balance, len(addrBalanceArray))
+	copy(sorted, addrBalanceArray)
+	sort.Slice(sorted, func(i int, j int) bool {
+		a_amount, _ := decimal.NewFromString(sorted[i].Balance)
+		b_amount, _ := decimal.NewFromString(sorted[j].Balance)
+		return a_amount.GreaterThan(b_amount)
+	})
+
+	var (
+		inputs = make([]*AddrBalance, 0)
+		remain = new(big.Int).Set(totalAmount)
+	)
+
+	for _, addrBalance := range sorted {
+
+		if remain.Sign() <= 0 {
+			break
+		}
+
+		if maxInputs > 0 && len(inputs) >= maxInputs {
+			break
+		}
+
+		addrBalance_BI := common.StringNumToBigIntWithExp(addrBalance.Balance, decimals)
+		if addrBalance_BI.Sign() <= 0 {
+			continue
+		}
+
+		use := addrBalance_BI
+		if use.Cmp(remain) > 0 {
+			use = new(big.Int).Set(remain)
+		}
+		remain.Sub(remain, use)
+
+		useDecimal := common.BigIntToDecimals(use, decimals)
+		inputs = append(inputs, &AddrBalance{Address: addrBalance.Address, Balance: &useDecimal})
+	}
+
+	if remain.Sign() > 0 {
+		return nil
+	}
+
+	return inputs
+}
+
+//getRawTransactionRemark 获取交易单扩展参数中的备注，兼容memo字段
+func getRawTransactionRemark(rawTx *openwallet.RawTransaction) string {
+	return getExtParamRemark(rawTx.GetExtParam())
+}
+
+//getSummaryRemark 获取汇总交易扩展参数中的备注，兼容memo字段
+func getSummaryRemark(sumRawTx *openwallet.SummaryRawTransaction) string {
+	return getExtParamRemark(sumRawTx.GetExtParam())
+}
+
+func getExtParamRemark(ext gjson.Result) string {
+	if remark := ext.Get("remark"); remark.Exists() {
+		return remark.String()
+	}
+	return ext.Get("memo").String()
+}
+
+//getRawTransactionLockTime 获取交易单扩展参数中的输出锁定时间，解锁高度或时间，-1 表示永久锁定
+func getRawTransactionLockTime(rawTx *openwallet.RawTransaction) (int64, error) {
+	lockTime := rawTx.GetExtParam().Get("lockTime")
+	if !lockTime.Exists() {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(lockTime.String(), 10, 64)
+	if err != nil || value < -1 {
+		return 0, fmt.Errorf("invalid lockTime: %s", lockTime.String())
+	}
+	return value, nil
+}
+
 func appendOutput(output map[string]decimal.Decimal, address string, amount decimal.Decimal) map[string]decimal.Decimal {
 	if origin, ok := output[address]; ok {
 		origin = origin.Add(amount)
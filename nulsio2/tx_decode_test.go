@@ -0,0 +1,317 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+package nulsio2
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
+	"github.com/blocktree/openwallet/v2/common"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//testAddress 生成测试用的主网地址
+func testAddress(seed byte) string {
+	addr := []byte{0x01, 0x00, 0x01}
+	for i := 0; i < 20; i++ {
+		addr = append(addr, seed+byte(i))
+	}
+	return nulsio2_trans.AddressBase58Encode(addr)
+}
+
+//testWalletDAI 测试用的钱包数据，账户下只有addresses中的地址
+type testWalletDAI struct {
+	openwallet.WalletDAIBase
+	addresses []string
+}
+
+func (dai *testWalletDAI) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	list := make([]*openwallet.Address, 0)
+	for _, address := range dai.addresses {
+		list = append(list, &openwallet.Address{AccountID: "account", Address: address})
+	}
+	return list, nil
+}
+
+func (dai *testWalletDAI) GetAddress(address string) (*openwallet.Address, error) {
+	return &openwallet.Address{AccountID: "account", Address: address}, nil
+}
+
+//newTestNode 测试用的浏览器节点，balances为地址的主币余额（最小单位），其他请求由handlers按路径前缀返回data
+func newTestNode(balances map[string]string, handlers map[string]func(r *http.Request) string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := ""
+		if strings.HasPrefix(r.URL.Path, "/api/accountledger/balance/") {
+			balance := balances[strings.TrimPrefix(r.URL.Path, "/api/accountledger/balance/")]
+			data = fmt.Sprintf(`{"total":"%s","available":"%s","nonce":"0000000000000000"}`, balance, balance)
+		}
+		for prefix, handler := range handlers {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				data = handler(r)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(data) == 0 {
+			fmt.Fprint(w, `{"success":false,"data":{"code":"err_0001","msg":"not found"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"success":true,"data":%s}`, data)
+	}))
+}
+
+//newTestDecoder 连接测试节点的交易单构建器
+func newTestDecoder(url string) *TransactionDecoder {
+	wm := NewWalletManager()
+	wm.Api = NewClient(url, false)
+	return NewTransactionDecoder(wm)
+}
+
+//newTestRawTransaction 账户的主币转账交易单
+func newTestRawTransaction(to map[string]string) *openwallet.RawTransaction {
+	return &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol},
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      to,
+	}
+}
+
+//errorCode 获取openwallet错误码，其他错误返回0
+func errorCode(err error) uint64 {
+	if owErr, ok := err.(*openwallet.Error); ok {
+		return owErr.Code()
+	}
+	return 0
+}
+
+//decodeTestRawHex 解析交易单的输入，返回 "地址:金额" 列表
+func decodeTestRawHex(t *testing.T, rawHex string) []string {
+	t.Helper()
+	txBytes, _ := hex.DecodeString(rawHex)
+	trx, err := nulsio2_trans.DecodeRawTransaction(txBytes)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction failed, unexpected error: %v", err)
+	}
+	vins := make([]string, 0)
+	for _, vin := range trx.GetVins() {
+		vins = append(vins, fmt.Sprintf("%s:%s", vin.Address, vin.Amount.String()))
+	}
+	return vins
+}
+
+func TestSelectMultiInputs(t *testing.T) {
+	balances := []*openwallet.Balance{
+		{Address: "A", Balance: "1"},
+		{Address: "B", Balance: "3"},
+		{Address: "C", Balance: "0"},
+		{Address: "D", Balance: "2"},
+	}
+
+	cases := []struct {
+		name      string
+		total     string
+		maxInputs int
+		inputs    []string
+	}{
+		//最后一个地址只使用不足的部分
+		{"shortfall", "4.5", 0, []string{"B:3", "D:1.5"}},
+		{"all", "6", 0, []string{"B:3", "D:2", "A:1"}},
+		{"single", "2.5", 0, []string{"B:2.5"}},
+		{"insufficient", "6.00000001", 0, nil},
+		//超出输入数量限制视为余额不足
+		{"max inputs", "4.5", 1, nil},
+		{"within max inputs", "4.5", 2, []string{"B:3", "D:1.5"}},
+	}
+
+	for _, c := range cases {
+		selected := selectMultiInputs(balances, common.StringNumToBigIntWithExp(c.total, 8), 8, c.maxInputs)
+
+		inputs := make([]string, 0)
+		for _, s := range selected {
+			inputs = append(inputs, fmt.Sprintf("%s:%s", s.Address, s.Balance.String()))
+		}
+		if c.inputs == nil {
+			if selected != nil {
+				t.Errorf("%s: should not select inputs: %v", c.name, inputs)
+			}
+			continue
+		}
+		if fmt.Sprint(inputs) != fmt.Sprint(c.inputs) {
+			t.Errorf("%s: unexpected inputs: %v", c.name, inputs)
+		}
+	}
+
+	//不修改调用者的余额顺序
+	if balances[0].Address != "A" || balances[3].Address != "D" {
+		t.Errorf("balances should not be sorted in place")
+	}
+}
+
+func TestCreateSimpleRawTransaction_MultiInputs(t *testing.T) {
+	var (
+		receiver = testAddress(50)
+		addrs    = make([]string, 0)
+		balances = make(map[string]string)
+	)
+	//7个地址，余额从1.06到1.00
+	for i := 0; i < 7; i++ {
+		addr := testAddress(byte(1 + i*20))
+		addrs = append(addrs, addr)
+		balances[addr] = fmt.Sprintf("%d", 106000000-i*1000000)
+	}
+	server := newTestNode(balances, nil)
+	defer server.Close()
+
+	cases := []struct {
+		name        string
+		amount      string
+		multiInputs bool
+		maxInputs   int
+		feeRate     string
+		inputs      []string
+		fees        string
+	}{
+		//单个地址余额足够时使用余额最小的地址
+		{"single address", "1", true, 50, "0.001", []string{addrs[5] + ":100100000"}, "0.00100000"},
+		{"multi inputs", "2.5", true, 50, "0.001", []string{addrs[0] + ":106000000", addrs[1] + ":105000000", addrs[2] + ":39100000"}, "0.00100000"},
+		//按1个输入计算的手续费需要7个输入，7个输入的交易超过1KB，重新计算手续费
+		{"fee re-estimated", "7.18", true, 50, "0.01", []string{
+			addrs[0] + ":106000000", addrs[1] + ":105000000", addrs[2] + ":104000000", addrs[3] + ":103000000",
+			addrs[4] + ":102000000", addrs[5] + ":101000000", addrs[6] + ":99000000",
+		}, "0.02000000"},
+		{"max inputs", "2.5", true, 2, "0.001", nil, ""},
+		{"disabled", "2.5", false, 50, "0.001", nil, ""},
+	}
+
+	for _, c := range cases {
+		decoder := newTestDecoder(server.URL)
+		decoder.wm.Config.MultiInputs = c.multiInputs
+		decoder.wm.Config.MaxTxInputs = c.maxInputs
+		decoder.wm.Config.FeeRate = c.feeRate
+
+		rawTx := newTestRawTransaction(map[string]string{receiver: c.amount})
+		_, err := decoder.CreateSimpleRawTransaction(&testWalletDAI{addresses: addrs}, rawTx)
+		if c.inputs == nil {
+			if errorCode(err) != openwallet.ErrInsufficientBalanceOfAddress {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: CreateSimpleRawTransaction failed, unexpected error: %v", c.name, err)
+			continue
+		}
+
+		if inputs := decodeTestRawHex(t, rawTx.RawHex); fmt.Sprint(inputs) != fmt.Sprint(c.inputs) {
+			t.Errorf("%s: unexpected inputs: %v", c.name, inputs)
+		}
+		if rawTx.Fees != c.fees {
+			t.Errorf("%s: unexpected fees: %s", c.name, rawTx.Fees)
+		}
+
+		//每个输入地址一个签名
+		keySigs := rawTx.Signatures["account"]
+		if len(keySigs) != len(c.inputs) {
+			t.Fatalf("%s: unexpected signatures count: %d", c.name, len(keySigs))
+		}
+		for i, keySig := range keySigs {
+			if !strings.HasPrefix(c.inputs[i], keySig.Address.Address+":") || keySig.Message != rawTx.TxID {
+				t.Errorf("%s: unexpected signature %d: %+v", c.name, i, keySig)
+			}
+		}
+		if len(rawTx.TxFrom) != len(c.inputs) {
+			t.Errorf("%s: unexpected tx from: %v", c.name, rawTx.TxFrom)
+		}
+	}
+}
+
+func TestSortedRecipients(t *testing.T) {
+	to := map[string]string{"C": "1", "A": "2", "B": "3"}
+	if addrs := sortedRecipients(to); fmt.Sprint(addrs) != "[A B C]" {
+		t.Errorf("unexpected recipients: %v", addrs)
+	}
+	if addrs := sortedRecipients(nil); len(addrs) != 0 {
+		t.Errorf("unexpected recipients: %v", addrs)
+	}
+}
+
+func TestCreateSimpleRawTransaction_Recipients(t *testing.T) {
+	sender := testAddress(1)
+	server := newTestNode(map[string]string{sender: "1000000000"}, nil)
+	defer server.Close()
+
+	cases := []struct {
+		name       string
+		recipients int
+		fees       string
+	}{
+		{"one", 1, "0.01000000"},
+		//按交易单字节数计算手续费，30个输出超过2KB
+		{"many", 30, "0.03000000"},
+	}
+
+	for _, c := range cases {
+		decoder := newTestDecoder(server.URL)
+		decoder.wm.Config.FeeRate = "0.01"
+
+		to := make(map[string]string)
+		for i := 0; i < c.recipients; i++ {
+			to[testAddress(byte(50+i))] = "0.1"
+		}
+
+		rawTx := newTestRawTransaction(to)
+		if _, err := decoder.CreateSimpleRawTransaction(&testWalletDAI{addresses: []string{sender}}, rawTx); err != nil {
+			t.Errorf("%s: CreateSimpleRawTransaction failed, unexpected error: %v", c.name, err)
+			continue
+		}
+
+		txBytes, _ := hex.DecodeString(rawTx.RawHex)
+		trx, err := nulsio2_trans.DecodeRawTransaction(txBytes)
+		if err != nil {
+			t.Fatalf("%s: DecodeRawTransaction failed, unexpected error: %v", c.name, err)
+		}
+		vouts := trx.GetVouts()
+		if len(vouts) != c.recipients || len(rawTx.TxTo) != c.recipients {
+			t.Fatalf("%s: unexpected outputs: %d, tx to: %d", c.name, len(vouts), len(rawTx.TxTo))
+		}
+
+		//输出和TxTo按地址排序
+		for i, addr := range sortedRecipients(to) {
+			if vouts[i].Address != addr || vouts[i].Amount.String() != "10000000" {
+				t.Errorf("%s: unexpected output %d: %+v", c.name, i, vouts[i])
+			}
+			if rawTx.TxTo[i] != addr+":0.1" {
+				t.Errorf("%s: unexpected tx to %d: %s", c.name, i, rawTx.TxTo[i])
+			}
+		}
+
+		if rawTx.Fees != c.fees {
+			t.Errorf("%s: unexpected fees: %s", c.name, rawTx.Fees)
+		}
+		//账户支出 = 转账总数 + 手续费
+		sent := common.StringNumToBigIntWithExp(fmt.Sprintf("%d", c.recipients), 7)
+		spent := common.BigIntToDecimals(sent.Add(sent, common.StringNumToBigIntWithExp(c.fees, 8)), 8)
+		if rawTx.TxAmount != spent.Neg().StringFixed(8) {
+			t.Errorf("%s: unexpected tx amount: %s", c.name, rawTx.TxAmount)
+		}
+		if len(rawTx.TxFrom) != 1 || rawTx.TxFrom[0] != sender+":"+spent.String() {
+			t.Errorf("%s: unexpected tx from: %v", c.name, rawTx.TxFrom)
+		}
+	}
+}
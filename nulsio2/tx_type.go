@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio2
+
+//NULS 2.0 协议交易类型
+const (
+	TxTypeCoinBase              = int32(1)
+	TxTypeTransfer              = int32(2)
+	TxTypeAccountAlias          = int32(3)
+	TxTypeRegisterAgent         = int32(4)
+	TxTypeDeposit               = int32(5)
+	TxTypeCancelDeposit         = int32(6)
+	TxTypeYellowPunish          = int32(7)
+	TxTypeRedPunish             = int32(8)
+	TxTypeStopAgent             = int32(9)
+	TxTypeCrossChain            = int32(10)
+	TxTypeRegisterChainAndAsset = int32(11)
+	TxTypeDestroyChainAndAsset  = int32(12)
+	TxTypeAddAssetToChain       = int32(13)
+	TxTypeRemoveAssetFromChain  = int32(14)
+	TxTypeCreateContract        = int32(15)
+	TxTypeCallContract          = int32(16)
+	TxTypeDeleteContract        = int32(17)
+	TxTypeContractTransfer      = int32(18)
+	TxTypeContractReturnGas     = int32(19)
+	TxTypeContractCreateAgent   = int32(20)
+	TxTypeContractDeposit       = int32(21)
+	TxTypeContractCancelDeposit = int32(22)
+	TxTypeContractStopAgent     = int32(23)
+	TxTypeVerifierChange        = int32(24)
+	TxTypeVerifierInit          = int32(25)
+)
+
+//openwallet交易类型，0:转账，1:合约调用，大于100为自定义类型，TxAction记录类型名称
+const (
+	WalletTxTypeTransfer  = uint64(0)
+	WalletTxTypeContract  = uint64(1)
+	WalletTxTypeCustomize = uint64(100)
+)
+
+//NulsTxType 交易类型的提取规则
+type NulsTxType struct {
+	Type    int32  //协议交易类型
+	Name    string //类型名称，记录到TxAction
+	TxType  uint64 //openwallet交易类型
+	Extract bool   //是否提取coinData的输入输出
+}
+
+//newCustomizeTxType 自定义的openwallet交易类型为 100 + 协议交易类型
+func newCustomizeTxType(t int32, name string) *NulsTxType {
+	return &NulsTxType{Type: t, Name: name, TxType: WalletTxTypeCustomize + uint64(t), Extract: true}
+}
+
+//nulsTxTypes 所有协议交易类型
+var nulsTxTypes = map[int32]*NulsTxType{
+	TxTypeCoinBase:              newCustomizeTxType(TxTypeCoinBase, "coinBase"),
+	TxTypeTransfer:              {Type: TxTypeTransfer, Name: "transfer", TxType: WalletTxTypeTransfer, Extract: true},
+	TxTypeAccountAlias:          newCustomizeTxType(TxTypeAccountAlias, "accountAlias"),
+	TxTypeRegisterAgent:         newCustomizeTxType(TxTypeRegisterAgent, "registerAgent"),
+	TxTypeDeposit:               newCustomizeTxType(TxTypeDeposit, "deposit"),
+	TxTypeCancelDeposit:         newCustomizeTxType(TxTypeCancelDeposit, "cancelDeposit"),
+	TxTypeYellowPunish:          newCustomizeTxType(TxTypeYellowPunish, "yellowPunish"),
+	TxTypeRedPunish:             newCustomizeTxType(TxTypeRedPunish, "redPunish"),
+	TxTypeStopAgent:             newCustomizeTxType(TxTypeStopAgent, "stopAgent"),
+	TxTypeCrossChain:            {Type: TxTypeCrossChain, Name: "crossChain", TxType: WalletTxTypeTransfer, Extract: true},
+	TxTypeRegisterChainAndAsset: newCustomizeTxType(TxTypeRegisterChainAndAsset, "registerChainAndAsset"),
+	TxTypeDestroyChainAndAsset:  newCustomizeTxType(TxTypeDestroyChainAndAsset, "destroyChainAndAsset"),
+	TxTypeAddAssetToChain:       newCustomizeTxType(TxTypeAddAssetToChain, "addAssetToChain"),
+	TxTypeRemoveAssetFromChain:  newCustomizeTxType(TxTypeRemoveAssetFromChain, "removeAssetFromChain"),
+	TxTypeCreateContract:        {Type: TxTypeCreateContract, Name: "createContract", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeCallContract:          {Type: TxTypeCallContract, Name: "callContract", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeDeleteContract:        {Type: TxTypeDeleteContract, Name: "deleteContract", TxType: WalletTxTypeContract, Extract: true},
+	//合约内部转账从合约调用的执行结果中提取，不重复提取
+	TxTypeContractTransfer:      {Type: TxTypeContractTransfer, Name: "contractTransfer", TxType: WalletTxTypeContract, Extract: false},
+	TxTypeContractReturnGas:     {Type: TxTypeContractReturnGas, Name: "contractReturnGas", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeContractCreateAgent:   {Type: TxTypeContractCreateAgent, Name: "contractCreateAgent", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeContractDeposit:       {Type: TxTypeContractDeposit, Name: "contractDeposit", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeContractCancelDeposit: {Type: TxTypeContractCancelDeposit, Name: "contractCancelDeposit", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeContractStopAgent:     {Type: TxTypeContractStopAgent, Name: "contractStopAgent", TxType: WalletTxTypeContract, Extract: true},
+	TxTypeVerifierChange:        newCustomizeTxType(TxTypeVerifierChange, "verifierChange"),
+	TxTypeVerifierInit:          newCustomizeTxType(TxTypeVerifierInit, "verifierInit"),
+}
+
+//GetNulsTxType 获取协议交易类型的提取规则，未知类型返回nil
+func GetNulsTxType(t int32) *NulsTxType {
+	return nulsTxTypes[t]
+}
@@ -56,6 +56,18 @@ func AddressBase58Decode(b string) []byte{
 	return Base58Decode(realAddress)
 }
 
+//AddressBase58Encode 地址字节（链ID+类型+hash160）编码为NULSd开头的地址
+func AddressBase58Encode(b []byte) string {
+	xor := byte(0)
+	for _, v := range b {
+		xor ^= v
+	}
+	body := make([]byte, 0, len(b)+1)
+	body = append(body, b...)
+	body = append(body, xor)
+	return "NULSd" + Base58Encode(body)
+}
+
 // Decode decodes a modified base58 string to a byte slice.
 func Base58Decode(b string) []byte {
 	answer := big.NewInt(0)
@@ -0,0 +1,323 @@
+package nulsio2_trans
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio2-adapter/nulsio2_addrdec"
+)
+
+const (
+	//UnsignedTxPackageVersion 离线签名包的格式版本
+	UnsignedTxPackageVersion = 1
+
+	//addressTypeNormal 普通账户地址类型
+	addressTypeNormal = 1
+)
+
+//UnsignedTxInput 待签名的输入，同一地址的多个输入共用一个签名，金额为最小单位的十进制字符串
+type UnsignedTxInput struct {
+	Address       string `json:"address"`
+	PublicKey     string `json:"publicKey"`
+	DerivedPath   string `json:"derivedPath"`
+	SigningHash   string `json:"signingHash"`
+	AssetsChainId uint64 `json:"assetsChainId"`
+	AssetsId      uint64 `json:"assetsId"`
+	Amount        string `json:"amount"`
+	Nonce         string `json:"nonce"`
+}
+
+//UnsignedTxOutput 交易输出，用于离线核对金额
+type UnsignedTxOutput struct {
+	Address       string `json:"address"`
+	AssetsChainId uint64 `json:"assetsChainId"`
+	AssetsId      uint64 `json:"assetsId"`
+	Amount        string `json:"amount"`
+	LockTime      uint64 `json:"lockTime"`
+}
+
+//UnsignedTxPackage 离线签名包，包含原始交易单、每个输入的签名哈希、派生路径和金额
+type UnsignedTxPackage struct {
+	Version int                 `json:"version"`
+	TxID    string              `json:"txid"`
+	TxType  int64               `json:"txType"`
+	Remark  string              `json:"remark"`
+	RawHex  string              `json:"rawHex"`
+	Inputs  []*UnsignedTxInput  `json:"inputs"`
+	Outputs []*UnsignedTxOutput `json:"outputs"`
+}
+
+//TxSignature 离线签名结果，Signature为64字节的r+s
+type TxSignature struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+//SignerKey 输入地址的公钥和派生路径
+type SignerKey struct {
+	PublicKey   string
+	DerivedPath string
+}
+
+//NewUnsignedTxPackage 根据未签名的交易单创建离线签名包，keys为输入地址对应的公钥和派生路径
+func NewUnsignedTxPackage(rawHex string, keys map[string]SignerKey) (*UnsignedTxPackage, error) {
+	txBytes, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, err
+	}
+
+	trx, bodyEnd, err := decodeRawTransaction(txBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	//只保留交易主体，签名由离线签名后重新装配
+	body := txBytes[:bodyEnd]
+	txId := hex.EncodeToString(Sha256Twice(body))
+
+	pkg := &UnsignedTxPackage{
+		Version: UnsignedTxPackageVersion,
+		TxID:    txId,
+		TxType:  trx.Type,
+		Remark:  trx.GetRemark(),
+		RawHex:  hex.EncodeToString(body),
+		Inputs:  make([]*UnsignedTxInput, 0, len(trx.Vins)),
+		Outputs: make([]*UnsignedTxOutput, 0, len(trx.Vouts)),
+	}
+
+	for _, vin := range trx.GetVins() {
+		key, ok := keys[vin.Address]
+		if !ok {
+			return nil, fmt.Errorf("key of input address: %s is missing", vin.Address)
+		}
+		pkg.Inputs = append(pkg.Inputs, &UnsignedTxInput{
+			Address:       vin.Address,
+			PublicKey:     key.PublicKey,
+			DerivedPath:   key.DerivedPath,
+			SigningHash:   txId,
+			AssetsChainId: vin.AssetsChainId,
+			AssetsId:      vin.AssetsId,
+			Amount:        vin.Amount.String(),
+			Nonce:         vin.Nonce,
+		})
+	}
+
+	for _, vout := range trx.GetVouts() {
+		pkg.Outputs = append(pkg.Outputs, &UnsignedTxOutput{
+			Address:       vout.Address,
+			AssetsChainId: vout.AssetsChainId,
+			AssetsId:      vout.AssetsId,
+			Amount:        vout.Amount.String(),
+			LockTime:      vout.LockTime,
+		})
+	}
+
+	return pkg, nil
+}
+
+//UnmarshalUnsignedTxPackage 解析JSON格式的离线签名包，并校验包内容与原始交易单一致
+func UnmarshalUnsignedTxPackage(data []byte) (*UnsignedTxPackage, error) {
+	var pkg UnsignedTxPackage
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+	if err := pkg.Check(); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+//Marshal 编码为JSON格式的离线签名包
+func (p *UnsignedTxPackage) Marshal() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+//Check 重新解析原始交易单，核对txid、签名哈希以及输入输出的地址和金额，防止签名包被篡改
+func (p *UnsignedTxPackage) Check() error {
+	if p.Version != UnsignedTxPackageVersion {
+		return fmt.Errorf("unsupported package version: %d", p.Version)
+	}
+
+	txBytes, err := hex.DecodeString(p.RawHex)
+	if err != nil {
+		return err
+	}
+
+	trx, bodyEnd, err := decodeRawTransaction(txBytes)
+	if err != nil {
+		return err
+	}
+	if bodyEnd != len(txBytes) {
+		return errors.New("raw transaction of package should not be signed")
+	}
+
+	txId := hex.EncodeToString(Sha256Twice(txBytes))
+	if p.TxID != txId {
+		return fmt.Errorf("txid of package: %s not equal to raw transaction: %s", p.TxID, txId)
+	}
+
+	if trx.Type != p.TxType || trx.GetRemark() != p.Remark {
+		return errors.New("type or remark of package not match raw transaction")
+	}
+
+	vins := trx.GetVins()
+	if len(vins) != len(p.Inputs) {
+		return fmt.Errorf("inputs count of package: %d not equal to raw transaction: %d", len(p.Inputs), len(vins))
+	}
+	for i, vin := range vins {
+		input := p.Inputs[i]
+		if input == nil || input.Address != vin.Address || input.AssetsChainId != vin.AssetsChainId ||
+			input.AssetsId != vin.AssetsId || input.Amount != vin.Amount.String() || input.Nonce != vin.Nonce {
+			return fmt.Errorf("input %d of package not match raw transaction", i)
+		}
+		if input.SigningHash != txId {
+			return fmt.Errorf("signing hash of input %d not match raw transaction", i)
+		}
+	}
+
+	vouts := trx.GetVouts()
+	if len(vouts) != len(p.Outputs) {
+		return fmt.Errorf("outputs count of package: %d not equal to raw transaction: %d", len(p.Outputs), len(vouts))
+	}
+	for i, vout := range vouts {
+		output := p.Outputs[i]
+		if output == nil || output.Address != vout.Address || output.AssetsChainId != vout.AssetsChainId ||
+			output.AssetsId != vout.AssetsId || output.Amount != vout.Amount.String() || output.LockTime != vout.LockTime {
+			return fmt.Errorf("output %d of package not match raw transaction", i)
+		}
+	}
+
+	return nil
+}
+
+//Signers 需要签名的输入，按输入顺序每个地址只保留一个
+func (p *UnsignedTxPackage) Signers() []*UnsignedTxInput {
+	signers := make([]*UnsignedTxInput, 0, len(p.Inputs))
+	signed := make(map[string]bool)
+	for _, input := range p.Inputs {
+		if signed[input.Address] {
+			continue
+		}
+		signed[input.Address] = true
+		signers = append(signers, input)
+	}
+	return signers
+}
+
+//VerifySignature 验证公钥对交易哈希的签名，公钥为压缩或非压缩格式
+func VerifySignature(pub, hash, signature []byte) bool {
+	if len(signature) != 64 {
+		return false
+	}
+	uncompressed := pub
+	if len(pub) == 33 {
+		uncompressed = owcrypt.PointDecompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+	}
+	if len(uncompressed) != 65 {
+		return false
+	}
+	return owcrypt.Verify(uncompressed[1:], nil, hash, signature, owcrypt.ECC_CURVE_SECP256K1) == owcrypt.SUCCESS
+}
+
+//CheckAddressPublicKey 校验公钥与地址匹配，地址由地址中的链ID、普通账户类型和公钥的hash160组成
+func CheckAddressPublicKey(address string, pub []byte) error {
+	addr := AddressBase58Decode(address)
+	if len(addr) < 23 {
+		return fmt.Errorf("invalid address: %s", address)
+	}
+
+	compressed := pub
+	if len(pub) == 65 {
+		compressed = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+	}
+	if len(compressed) != 33 {
+		return fmt.Errorf("invalid public key of address: %s", address)
+	}
+
+	body := make([]byte, 0, 23)
+	body = append(body, addr[:2]...)
+	body = append(body, addressTypeNormal)
+	body = append(body, nulsio2_addrdec.Sha256hash160(compressed)...)
+	if AddressBase58Encode(body) != address {
+		return fmt.Errorf("public key not match address: %s", address)
+	}
+	return nil
+}
+
+//AssembleSignedTransaction 按输入地址顺序将签名装配到交易单，返回已签名的交易单hex，已有的签名会被替换
+func AssembleSignedTransaction(rawHex string, signatures []*TxSignature) (string, error) {
+	txBytes, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return "", err
+	}
+
+	trx, bodyEnd, err := decodeRawTransaction(txBytes)
+	if err != nil {
+		return "", err
+	}
+
+	body := txBytes[:bodyEnd]
+	txHash := Sha256Twice(body)
+
+	addrSignatures := make(map[string]*TxSignature)
+	for _, s := range signatures {
+		if s == nil {
+			continue
+		}
+		addrSignatures[s.Address] = s
+	}
+
+	sigPubByte := make([]byte, 0)
+
+	signed := make(map[string]bool)
+	for _, vin := range trx.GetVins() {
+
+		if signed[vin.Address] {
+			continue
+		}
+
+		s, ok := addrSignatures[vin.Address]
+		if !ok || len(s.Signature) == 0 {
+			return "", fmt.Errorf("signature of address: %s is missing", vin.Address)
+		}
+
+		signature, err := hex.DecodeString(s.Signature)
+		if err != nil {
+			return "", fmt.Errorf("invalid signature of address: %s", vin.Address)
+		}
+		pub, err := hex.DecodeString(s.PublicKey)
+		if err != nil {
+			return "", fmt.Errorf("invalid public key of address: %s", vin.Address)
+		}
+
+		if err := CheckAddressPublicKey(vin.Address, pub); err != nil {
+			return "", err
+		}
+
+		if !VerifySignature(pub, txHash, signature) {
+			return "", fmt.Errorf("signature of address: %s verify failed", vin.Address)
+		}
+
+		sigPub := &SigPub{
+			PublicKey: pub,
+			Signature: signature,
+		}
+
+		sigPubByte = append(sigPubByte, byte(len(pub)))
+		sigPubByte = append(sigPubByte, pub...)
+		sigPubByte = append(sigPubByte, sigPub.ToBytes()...)
+		signed[vin.Address] = true
+	}
+
+	sigPubByte, _ = GetBytesWithLength(sigPubByte)
+
+	rawBytes := make([]byte, 0, len(body)+len(sigPubByte))
+	rawBytes = append(rawBytes, body...)
+	rawBytes = append(rawBytes, sigPubByte...)
+
+	return hex.EncodeToString(rawBytes), nil
+}
@@ -2,7 +2,10 @@ package nulsio2_trans
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/big"
 )
 
@@ -77,6 +80,32 @@ func VarIntEncode(value int64) []byte {
 	}
 }
 
+//VarIntDecode 解析变长整数，返回数值及其占用的字节数
+func VarIntDecode(data []byte) (int64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, errors.New("Invalid varint data length!")
+	}
+	switch data[0] {
+	case 253:
+		if len(data) < 3 {
+			return 0, 0, errors.New("Invalid varint data length!")
+		}
+		return int64(data[1]) | int64(data[2])<<8, 3, nil
+	case 254:
+		if len(data) < 5 {
+			return 0, 0, errors.New("Invalid varint data length!")
+		}
+		return int64(binary.LittleEndian.Uint32(data[1:5])), 5, nil
+	case 255:
+		if len(data) < 9 {
+			return 0, 0, errors.New("Invalid varint data length!")
+		}
+		return int64(binary.LittleEndian.Uint64(data[1:9])), 9, nil
+	default:
+		return int64(data[0]), 1, nil
+	}
+}
+
 func GetInputOwnerKey(hexStr string, index int64) ([]byte, error) {
 	scriptPubkey, err := hex.DecodeString(hexStr)
 	if err != nil {
@@ -95,6 +124,30 @@ func GetBytesWithLength(target []byte) ([]byte, error) {
 	return result, nil
 }
 
+//readBytesWithLength 读取带长度前缀的数据，返回数据内容及占用的总字节数
+func readBytesWithLength(data []byte) ([]byte, int, error) {
+	length, size, err := VarIntDecode(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if length < 0 || int64(len(data)-size) < length {
+		return nil, 0, errors.New("Invalid data length!")
+	}
+	return data[size : size+int(length)], size + int(length), nil
+}
+
+//nextBytesWithLength 从index开始截取带长度前缀的数据（包含前缀），返回数据及下一个位置
+func nextBytesWithLength(data []byte, index int) ([]byte, int, error) {
+	if index > len(data) {
+		return nil, 0, errors.New("Invalid data length!")
+	}
+	_, size, err := readBytesWithLength(data[index:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return data[index : index+size], index + size, nil
+}
+
 func Sha256Twice(target []byte) []byte {
 	h := sha256.New()
 	h.Write(target)
@@ -103,13 +156,33 @@ func Sha256Twice(target []byte) []byte {
 	return h2.Sum(nil)
 }
 
-func WriteBigInteger(val int64) []byte {
-	result3 := big.NewInt(val).Bytes()
-
+//WriteBigInteger 将金额写为小端序32字节整数，nil视为0，不支持负数
+func WriteBigInteger(val *big.Int) ([]byte, error) {
 	result4 := make([]byte, 32)
+	if val == nil {
+		return result4, nil
+	}
+	if val.Sign() < 0 {
+		return nil, fmt.Errorf("negative amount: %s", val.String())
+	}
+
+	result3 := val.Bytes()
+	if len(result3) > 32 {
+		return nil, fmt.Errorf("amount: %s overflow 32 bytes", val.String())
+	}
+
 	for i := len(result3) - 1; i >= 0; i-- {
 		result4[len(result3)-1-i] = result3[i]
 	}
 
-	return result4
+	return result4, nil
+}
+
+//ReadBigInteger 解析WriteBigInteger写入的小端序32字节整数
+func ReadBigInteger(data []byte) *big.Int {
+	bigEndian := make([]byte, len(data))
+	for i := range data {
+		bigEndian[len(data)-1-i] = data[i]
+	}
+	return new(big.Int).SetBytes(bigEndian)
 }
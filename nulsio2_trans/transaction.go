@@ -3,13 +3,18 @@ package nulsio2_trans
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"unicode/utf8"
 )
 
 type Vin struct {
 	Address  string
 	AssetsChainId uint64
 	AssetsId uint64
-	Amount   uint64
+	Amount   *big.Int
 	Nonce   string
 	LockTime uint64
 }
@@ -19,7 +24,7 @@ type Vout struct {
 	Address  string
 	AssetsChainId uint64
 	AssetsId uint64
-	Amount   uint64
+	Amount   *big.Int
 	Nonce   string
 	LockTime uint64
 }
@@ -47,8 +52,64 @@ const (
 	DefaultHashType  = uint32(1)
 )
 
+const (
+	TxTypeTransfer     = int64(2)  //转账交易
+	TxTypeCallContract = int64(16) //调用合约交易
+)
+
+//TxClock 交易单创建时间的时钟，测试时可替换为固定时间以得到可复现的编码结果
+var TxClock = time.Now
+
+//MaxRemarkLength 交易备注的最大字节数
+const MaxRemarkLength = 1024
+
+//CheckRemark 检查交易备注是否为合法的UTF-8字符串且不超过长度限制
+func CheckRemark(remark string) error {
+	if !utf8.ValidString(remark) {
+		return errors.New("remark is not a valid utf-8 string")
+	}
+	if len([]byte(remark)) > MaxRemarkLength {
+		return fmt.Errorf("remark length exceeds %d bytes", MaxRemarkLength)
+	}
+	return nil
+}
+
+const (
+	TxFromSize      = 70  //单个输入的字节数：地址(1+23) + 资产链ID(2) + 资产ID(2) + 数量(32) + nonce(1+8) + 锁定标记(1)
+	TxToSize        = 68  //单个输出的字节数：地址(1+23) + 资产链ID(2) + 资产ID(2) + 数量(32) + 锁定时间(8)
+	TxSignatureSize = 107 //单个签名的最大字节数：公钥(1+33) + DER签名(1+72)
+)
+
+//EstimateTxSize 按输入、输出数量计算交易单字节数，签名部分按每个签名者的最大签名长度计算
+func EstimateTxSize(inputs, outputs int, remark []byte, txDataLen int, signers int) int64 {
+
+	coinDataLen := sizeOf(int64(inputs)) + int64(inputs)*TxFromSize + sizeOf(int64(outputs)) + int64(outputs)*TxToSize
+
+	//类型(2) + 时间(4)
+	size := int64(6)
+	size += sizeOf(int64(len(remark))) + int64(len(remark))
+	size += sizeOf(int64(txDataLen)) + int64(txDataLen)
+	size += sizeOf(coinDataLen) + coinDataLen
+
+	if signers > 0 {
+		sigLen := int64(signers) * TxSignatureSize
+		size += sizeOf(sigLen) + sigLen
+	}
+
+	return size
+}
+
 func CreateEmptyRawTransaction(vins []Vin, vouts []Vout, remark string, lockTime uint32, replaceable bool,txData *TxToken) (string, []byte, error) {
-	emptyTrans, err := newTransaction(vins, vouts, nil, lockTime, txData,replaceable)
+	if err := CheckRemark(remark); err != nil {
+		return "", nil, err
+	}
+
+	var remarkBytes []byte
+	if len(remark) > 0 {
+		remarkBytes = []byte(remark)
+	}
+
+	emptyTrans, err := newTransaction(vins, vouts, remarkBytes, lockTime, txData,replaceable)
 	if err != nil {
 		return "", nil, err
 	}
@@ -64,6 +125,20 @@ func CreateEmptyRawTransaction(vins []Vin, vouts []Vout, remark string, lockTime
 }
 
 
+//CalcTxHash 计算交易单哈希，即对不含签名部分的交易主体做两次sha256，与节点生成的txid一致
+func CalcTxHash(txHex string) (string, error) {
+	txBytes, err := hex.DecodeString(txHex)
+	if err != nil {
+		return "", err
+	}
+
+	_, bodyEnd, err := decodeRawTransaction(txBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(Sha256Twice(txBytes[:bodyEnd])), nil
+}
 
 type SigPub struct {
 	PublicKey []byte
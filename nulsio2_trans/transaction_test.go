@@ -0,0 +1,557 @@
+package nulsio2_trans
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio2-adapter/nulsio2_addrdec"
+)
+
+const goldenTransferHex = "020000105e5f00008c01170100010102030405060708090a0b0c0d0e0f101112131401000100a067f7050000000000000000000000000000000000000000000000000000000008010203040506070800011701000132333435363738393a3b3c3d3e3f4041424344450100010000e1f505000000000000000000000000000000000000000000000000000000000000000000000000"
+
+//testAddress 生成测试用的主网地址
+func testAddress(seed byte) string {
+	addr := []byte{0x01, 0x00, 0x01}
+	for i := 0; i < 20; i++ {
+		addr = append(addr, seed+byte(i))
+	}
+	return AddressBase58Encode(addr)
+}
+
+func TestAddressBase58Encode(t *testing.T) {
+	address := testAddress(1)
+	if address[:5] != "NULSd" {
+		t.Fatalf("unexpected address prefix: %s", address)
+	}
+	decoded := AddressBase58Decode(address)
+	if AddressBase58Encode(decoded) != address {
+		t.Fatalf("address round trip failed: %s", address)
+	}
+}
+
+//testTransfer 测试用的单输入单输出主资产转账，输入比输出多0.001作为手续费
+func testTransfer(nonce string) ([]Vin, []Vout) {
+	vins := []Vin{{
+		Address:       testAddress(1),
+		AssetsChainId: 1,
+		AssetsId:      1,
+		Amount:        big.NewInt(100100000),
+		Nonce:         nonce,
+	}}
+	vouts := []Vout{{
+		Address:       testAddress(50),
+		AssetsChainId: 1,
+		AssetsId:      1,
+		Amount:        big.NewInt(100000000),
+	}}
+	return vins, vouts
+}
+
+//testAmount 解析十进制金额
+func testAmount(amount string) *big.Int {
+	value, _ := new(big.Int).SetString(amount, 10)
+	return value
+}
+
+//equalVin 比较输入，金额按数值比较
+func equalVin(a, b Vin) bool {
+	return a.Address == b.Address && a.AssetsChainId == b.AssetsChainId && a.AssetsId == b.AssetsId &&
+		a.Amount.Cmp(b.Amount) == 0 && a.Nonce == b.Nonce && a.LockTime == b.LockTime
+}
+
+//equalVout 比较输出，金额按数值比较
+func equalVout(a, b Vout) bool {
+	return a.Address == b.Address && a.AssetsChainId == b.AssetsChainId && a.AssetsId == b.AssetsId &&
+		a.Amount.Cmp(b.Amount) == 0 && a.LockTime == b.LockTime
+}
+
+//mustCreateRawTransaction 创建交易单并解析，返回交易单hex和解析结果
+func mustCreateRawTransaction(t *testing.T, vins []Vin, vouts []Vout, remark string, token *TxToken) (string, *Transaction) {
+	t.Helper()
+	txHex, _, err := CreateEmptyRawTransaction(vins, vouts, remark, 0, false, token)
+	if err != nil {
+		t.Fatalf("CreateEmptyRawTransaction failed, unexpected error: %v", err)
+	}
+	txBytes, _ := hex.DecodeString(txHex)
+	rawTx, err := DecodeRawTransaction(txBytes)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction failed, unexpected error: %v", err)
+	}
+	return txHex, rawTx
+}
+
+//testSigData 按交易单格式编码的签名部分
+func testSigData(pub, signature []byte) []byte {
+	sigPub := SigPub{PublicKey: pub, Signature: signature}
+	sigData := append([]byte{byte(len(pub))}, pub...)
+	sigData = append(sigData, sigPub.ToBytes()...)
+	sigData, _ = GetBytesWithLength(sigData)
+	return sigData
+}
+
+func TestDecodeRawTransaction(t *testing.T) {
+	_, transferVouts := testTransfer("")
+	lockedVouts := append(transferVouts,
+		//按高度锁定
+		Vout{Address: testAddress(60), AssetsChainId: 1, AssetsId: 1, Amount: big.NewInt(100000000), LockTime: 3000000},
+		//永久锁定
+		Vout{Address: testAddress(70), AssetsChainId: 1, AssetsId: 1, Amount: big.NewInt(100000000), LockTime: 0xFFFFFFFFFFFFFFFF},
+	)
+
+	cases := []struct {
+		name   string
+		remark string
+		vouts  []Vout
+	}{
+		{"transfer", "", transferVouts},
+		{"remark", "memo:10086 充值", transferVouts},
+		{"lockTime", "", lockedVouts},
+	}
+
+	for _, c := range cases {
+		vins, _ := testTransfer("0102030405060708")
+		_, rawTx := mustCreateRawTransaction(t, vins, c.vouts, c.remark, nil)
+
+		if rawTx.Type != 2 {
+			t.Errorf("%s: unexpected tx type: %d", c.name, rawTx.Type)
+		}
+		if len(rawTx.Signatures) != 0 {
+			t.Errorf("%s: unsigned transaction should not have signatures", c.name)
+		}
+		if rawTx.GetRemark() != c.remark {
+			t.Errorf("%s: unexpected remark: %s", c.name, rawTx.GetRemark())
+		}
+		for i, out := range rawTx.Vouts {
+			if len(out.Locked) != 8 {
+				t.Errorf("%s: unexpected locked length of output %d: %d", c.name, i, len(out.Locked))
+			}
+		}
+
+		decodedVins := rawTx.GetVins()
+		if len(decodedVins) != 1 || !equalVin(decodedVins[0], vins[0]) {
+			t.Errorf("%s: unexpected vins: %+v", c.name, decodedVins)
+		}
+		decodedVouts := rawTx.GetVouts()
+		if len(decodedVouts) != len(c.vouts) {
+			t.Fatalf("%s: unexpected vouts count: %d", c.name, len(decodedVouts))
+		}
+		for i := range c.vouts {
+			if !equalVout(decodedVouts[i], c.vouts[i]) {
+				t.Errorf("%s: unexpected vout %d: %+v", c.name, i, decodedVouts[i])
+			}
+		}
+	}
+
+	vins, _ := testTransfer("0102030405060708")
+	_, rawTx := mustCreateRawTransaction(t, vins, lockedVouts, "", nil)
+	if !bytes.Equal(rawTx.Vouts[2].Locked, bytes.Repeat([]byte{0xff}, 8)) {
+		t.Errorf("unexpected permanent locked bytes: %x", rawTx.Vouts[2].Locked)
+	}
+}
+
+func TestDecodeRawTransaction_Signed(t *testing.T) {
+	vins, vouts := testTransfer("0000000000000000")
+	txHex, _ := mustCreateRawTransaction(t, vins, vouts, "", nil)
+	txBytes, _ := hex.DecodeString(txHex)
+
+	pub := bytes.Repeat([]byte{0x02}, 33)
+	signature := append(bytes.Repeat([]byte{0x81}, 32), bytes.Repeat([]byte{0x11}, 32)...)
+	signed := append(append([]byte{}, txBytes...), testSigData(pub, signature)...)
+
+	rawTx, err := DecodeRawTransaction(signed)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction failed, unexpected error: %v", err)
+	}
+	if len(rawTx.Signatures) != 1 {
+		t.Fatalf("unexpected signatures count: %d", len(rawTx.Signatures))
+	}
+	if !bytes.Equal(rawTx.Signatures[0].PublicKey, pub) {
+		t.Errorf("unexpected public key: %x", rawTx.Signatures[0].PublicKey)
+	}
+	if !bytes.Equal(rawTx.Signatures[0].Signature, signature) {
+		t.Errorf("unexpected signature: %x", rawTx.Signatures[0].Signature)
+	}
+}
+
+func TestDecodeRawTransaction_Invalid(t *testing.T) {
+	invalids := []string{
+		"",
+		"0200",
+		"0200a1b2c3d400",
+		"0200a1b2c3d40000ff",
+	}
+	for _, v := range invalids {
+		txBytes, _ := hex.DecodeString(v)
+		if _, err := DecodeRawTransaction(txBytes); err == nil {
+			t.Errorf("decode %s should fail", v)
+		}
+	}
+}
+
+func TestCalcTxHash(t *testing.T) {
+	vins, vouts := testTransfer("0000000000000000")
+	txHex, _ := mustCreateRawTransaction(t, vins, vouts, "", nil)
+	txBytes, _ := hex.DecodeString(txHex)
+
+	hash, err := CalcTxHash(txHex)
+	if err != nil {
+		t.Fatalf("CalcTxHash failed, unexpected error: %v", err)
+	}
+	if hash != hex.EncodeToString(Sha256Twice(txBytes)) {
+		t.Errorf("unexpected unsigned tx hash: %s", hash)
+	}
+
+	//签名部分不参与哈希计算
+	sigData := testSigData(bytes.Repeat([]byte{0x03}, 33), bytes.Repeat([]byte{0x22}, 64))
+	signedHash, err := CalcTxHash(txHex + hex.EncodeToString(sigData))
+	if err != nil {
+		t.Fatalf("CalcTxHash failed, unexpected error: %v", err)
+	}
+	if signedHash != hash {
+		t.Errorf("signed tx hash %s not equal to unsigned tx hash %s", signedHash, hash)
+	}
+}
+
+func TestCreateEmptyRawTransaction_Deterministic(t *testing.T) {
+	defer func(clock func() time.Time) { TxClock = clock }(TxClock)
+	TxClock = func() time.Time { return time.Unix(1600000000, 0) }
+
+	vins, vouts := testTransfer("0102030405060708")
+	txHex, rawTx := mustCreateRawTransaction(t, vins, vouts, "", nil)
+	if txHex != goldenTransferHex {
+		t.Errorf("unexpected tx hex: %s", txHex)
+	}
+
+	//解析后保留交易时间
+	if rawTx.Time != 1600000000 {
+		t.Errorf("unexpected tx time: %d", rawTx.Time)
+	}
+	//更换时钟后重新编码，交易时间不变
+	TxClock = time.Now
+	encoded, err := rawTx.encodeToBytes()
+	if err != nil {
+		t.Fatalf("encodeToBytes failed, unexpected error: %v", err)
+	}
+	txBytes, _ := hex.DecodeString(txHex)
+	if !bytes.Equal(encoded, txBytes) {
+		t.Errorf("re-encoded tx %x not equal to %x", encoded, txBytes)
+	}
+}
+
+func TestCreateEmptyRawTransaction_InvalidRemark(t *testing.T) {
+	vins, vouts := testTransfer("0000000000000000")
+	invalids := []string{
+		string([]byte{0xff, 0xfe}),
+		string(bytes.Repeat([]byte("a"), MaxRemarkLength+1)),
+	}
+	for _, v := range invalids {
+		if _, _, err := CreateEmptyRawTransaction(vins, vouts, v, 0, false, nil); err == nil {
+			t.Errorf("remark %q should be rejected", v)
+		}
+	}
+}
+
+func TestCreateEmptyRawTransaction_Assets(t *testing.T) {
+	assets := []struct {
+		chainId uint64
+		assetId uint64
+		amount  string
+	}{
+		{1, 1, "500000000"},
+		{1, 2, "500000000"},
+		{2, 1, "500000000"},
+		{9, 1, "500000000"},
+		{5, 3, "500000000"},
+		{258, 513, "500000000"},
+		{65535, 65535, "500000000"},
+		//18位精度的资产，金额超出uint64
+		{9, 2, "123456789000000000000000000"},
+	}
+
+	for _, asset := range assets {
+		vins := []Vin{
+			{
+				Address:       testAddress(1),
+				AssetsChainId: asset.chainId,
+				AssetsId:      asset.assetId,
+				Amount:        testAmount(asset.amount),
+				Nonce:         "0102030405060708",
+			},
+			{
+				//手续费始终使用主资产支付
+				Address:       testAddress(1),
+				AssetsChainId: 1,
+				AssetsId:      1,
+				Amount:        big.NewInt(100000),
+				Nonce:         "1112131415161718",
+			},
+		}
+		vouts := []Vout{{
+			Address:       testAddress(50),
+			AssetsChainId: asset.chainId,
+			AssetsId:      asset.assetId,
+			Amount:        testAmount(asset.amount),
+		}}
+
+		_, rawTx := mustCreateRawTransaction(t, vins, vouts, "", nil)
+
+		//资产链ID在前，资产ID在后
+		vin := rawTx.Vins[0]
+		if !bytes.Equal(vin.AssetsChainId, uint16ToLittleEndianBytes(uint16(asset.chainId))) ||
+			!bytes.Equal(vin.AssetsId, uint16ToLittleEndianBytes(uint16(asset.assetId))) {
+			t.Errorf("asset %d-%d: unexpected input asset bytes %x-%x", asset.chainId, asset.assetId, vin.AssetsChainId, vin.AssetsId)
+		}
+
+		decodedVins := rawTx.GetVins()
+		if len(decodedVins) != len(vins) {
+			t.Fatalf("asset %d-%d: unexpected vins count: %d", asset.chainId, asset.assetId, len(decodedVins))
+		}
+		for i := range vins {
+			if !equalVin(decodedVins[i], vins[i]) {
+				t.Errorf("asset %d-%d: unexpected vin: %+v", asset.chainId, asset.assetId, decodedVins[i])
+			}
+		}
+		decodedVouts := rawTx.GetVouts()
+		if len(decodedVouts) != 1 || !equalVout(decodedVouts[0], vouts[0]) {
+			t.Errorf("asset %d-%d: unexpected vouts: %+v", asset.chainId, asset.assetId, decodedVouts)
+		}
+	}
+
+	invalids := []Vout{
+		{Address: testAddress(50), AssetsChainId: 0, AssetsId: 1, Amount: big.NewInt(1)},
+		{Address: testAddress(50), AssetsChainId: 1, AssetsId: 0, Amount: big.NewInt(1)},
+		{Address: testAddress(50), AssetsChainId: 65536, AssetsId: 1, Amount: big.NewInt(1)},
+		//负数和超出32字节的金额
+		{Address: testAddress(50), AssetsChainId: 1, AssetsId: 1, Amount: big.NewInt(-1)},
+		{Address: testAddress(50), AssetsChainId: 1, AssetsId: 1, Amount: new(big.Int).Lsh(big.NewInt(1), 256)},
+	}
+	vins, _ := testTransfer("0000000000000000")
+	for _, v := range invalids {
+		if _, _, err := CreateEmptyRawTransaction(vins, []Vout{v}, "", 0, false, nil); err == nil {
+			t.Errorf("output %d-%d of amount %s should be rejected", v.AssetsChainId, v.AssetsId, v.Amount.String())
+		}
+	}
+}
+
+func TestEstimateTxSize(t *testing.T) {
+	txBytes, _ := hex.DecodeString(goldenTransferHex)
+	if size := EstimateTxSize(1, 1, nil, 0, 0); size != int64(len(txBytes)) {
+		t.Errorf("unexpected unsigned tx size: %d, actual: %d", size, len(txBytes))
+	}
+
+	vins, _ := testTransfer("0000000000000000")
+	vouts := make([]Vout, 0)
+	for i := 0; i < 40; i++ {
+		vouts = append(vouts, Vout{
+			Address:       testAddress(byte(50 + i)),
+			AssetsChainId: 1,
+			AssetsId:      1,
+			Amount:        big.NewInt(1000000),
+		})
+	}
+
+	remark := "batch payment"
+	txHex, _ := mustCreateRawTransaction(t, vins, vouts, remark, nil)
+	txBytes, _ = hex.DecodeString(txHex)
+	if size := EstimateTxSize(len(vins), len(vouts), []byte(remark), 0, 0); size != int64(len(txBytes)) {
+		t.Errorf("unexpected unsigned tx size: %d, actual: %d", size, len(txBytes))
+	}
+
+	//签名部分按最大长度估算，不小于实际长度
+	sigData := testSigData(bytes.Repeat([]byte{0x02}, 33), bytes.Repeat([]byte{0x81}, 64))
+	signedSize := int64(len(txBytes) + len(sigData))
+	if size := EstimateTxSize(len(vins), len(vouts), []byte(remark), 0, 1); size != signedSize {
+		t.Errorf("unexpected signed tx size: %d, actual: %d", size, signedSize)
+	}
+}
+
+func TestEstimateTxSize_Token(t *testing.T) {
+	vins, _ := testTransfer("0000000000000000")
+	token := &TxToken{
+		Sender:          testAddress(1),
+		ContractAddress: testAddress(90),
+		GasLimit:        35000,
+		Price:           25,
+		MethodName:      "transfer",
+		ArgsCount:       2,
+		Args:            []string{testAddress(50), "100000000"},
+	}
+
+	txHex, rawTx := mustCreateRawTransaction(t, vins, nil, "", token)
+	txBytes, _ := hex.DecodeString(txHex)
+	if token.Size() != len(rawTx.TxData) {
+		t.Errorf("unexpected token size: %d, actual: %d", token.Size(), len(rawTx.TxData))
+	}
+	if size := EstimateTxSize(1, 0, nil, token.Size(), 0); size != int64(len(txBytes)) {
+		t.Errorf("unexpected contract call tx size: %d, actual: %d", size, len(txBytes))
+	}
+}
+
+func TestDecodeTxToken(t *testing.T) {
+	token := &TxToken{
+		Sender:          testAddress(1),
+		ContractAddress: testAddress(90),
+		Value:           big.NewInt(200000000),
+		GasLimit:        120000,
+		Price:           25,
+		MethodName:      "stake",
+		MethodDesc:      "(String[] pools, BigInteger amount) void",
+		MultiArgs: [][]string{
+			{testAddress(30), testAddress(31)},
+			{"500000000"},
+			{},
+		},
+	}
+
+	data, err := newTxTokenToBytes(token)
+	if err != nil {
+		t.Fatalf("newTxTokenToBytes failed, unexpected error: %v", err)
+	}
+
+	decoded, err := DecodeTxToken(data)
+	if err != nil {
+		t.Fatalf("DecodeTxToken failed, unexpected error: %v", err)
+	}
+
+	if decoded.Sender != token.Sender || decoded.ContractAddress != token.ContractAddress ||
+		decoded.Value.Cmp(token.Value) != 0 || decoded.GasLimit != token.GasLimit || decoded.Price != token.Price ||
+		decoded.MethodName != token.MethodName || decoded.MethodDesc != token.MethodDesc {
+		t.Errorf("unexpected token: %+v", decoded)
+	}
+	if len(decoded.MultiArgs) != len(token.MultiArgs) {
+		t.Fatalf("unexpected args count: %d", len(decoded.MultiArgs))
+	}
+	for i := range token.MultiArgs {
+		if len(decoded.MultiArgs[i]) != len(token.MultiArgs[i]) {
+			t.Fatalf("unexpected arg %d: %v", i, decoded.MultiArgs[i])
+		}
+		for j := range token.MultiArgs[i] {
+			if decoded.MultiArgs[i][j] != token.MultiArgs[i][j] {
+				t.Errorf("unexpected arg %d: %v", i, decoded.MultiArgs[i])
+			}
+		}
+	}
+
+	//单值参数编码为只有一个元素的数组
+	transfer := &TxToken{
+		Sender:          testAddress(1),
+		ContractAddress: testAddress(90),
+		GasLimit:        35000,
+		Price:           25,
+		MethodName:      "transfer",
+		ArgsCount:       2,
+		Args:            []string{testAddress(50), "100"},
+	}
+	data, _ = newTxTokenToBytes(transfer)
+	decoded, err = DecodeTxToken(data)
+	if err != nil {
+		t.Fatalf("DecodeTxToken failed, unexpected error: %v", err)
+	}
+	if len(decoded.MultiArgs) != 2 || len(decoded.MultiArgs[0]) != 1 || decoded.MultiArgs[1][0] != "100" {
+		t.Errorf("unexpected transfer args: %v", decoded.MultiArgs)
+	}
+}
+
+func TestUnsignedTxPackage(t *testing.T) {
+	prikey := bytes.Repeat([]byte{0x07}, 32)
+	pub, _ := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+
+	//输入地址由公钥生成
+	address := AddressBase58Encode(append([]byte{0x01, 0x00, 0x01}, nulsio2_addrdec.Sha256hash160(pub)...))
+	if err := CheckAddressPublicKey(address, pub); err != nil {
+		t.Fatalf("CheckAddressPublicKey failed, unexpected error: %v", err)
+	}
+	if err := CheckAddressPublicKey(testAddress(1), pub); err == nil {
+		t.Errorf("check of mismatched address should fail")
+	}
+
+	vins, vouts := testTransfer("0000000000000000")
+	vins[0].Address = address
+	txHex, _ := mustCreateRawTransaction(t, vins, vouts, "offline", nil)
+
+	keys := map[string]SignerKey{
+		address: {PublicKey: hex.EncodeToString(pub), DerivedPath: "m/44'/88'/0'/0/0"},
+	}
+	pkg, err := NewUnsignedTxPackage(txHex, keys)
+	if err != nil {
+		t.Fatalf("NewUnsignedTxPackage failed, unexpected error: %v", err)
+	}
+
+	//JSON往返后内容不变
+	data, err := pkg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed, unexpected error: %v", err)
+	}
+	decoded, err := UnmarshalUnsignedTxPackage(data)
+	if err != nil {
+		t.Fatalf("UnmarshalUnsignedTxPackage failed, unexpected error: %v", err)
+	}
+	txId, _ := CalcTxHash(txHex)
+	if decoded.TxID != txId || decoded.Remark != "offline" || len(decoded.Inputs) != 1 || len(decoded.Outputs) != 1 {
+		t.Fatalf("unexpected package: %s", data)
+	}
+	if decoded.Inputs[0].SigningHash != txId || decoded.Inputs[0].Amount != "100100000" || decoded.Inputs[0].DerivedPath != "m/44'/88'/0'/0/0" {
+		t.Errorf("unexpected input: %+v", decoded.Inputs[0])
+	}
+
+	//篡改金额后校验失败
+	decoded.Outputs[0].Amount = "1"
+	if err := decoded.Check(); err == nil {
+		t.Errorf("check of tampered package should fail")
+	}
+
+	hash, _ := hex.DecodeString(pkg.Inputs[0].SigningHash)
+	signature, _, _ := owcrypt.Signature(prikey, nil, hash, owcrypt.ECC_CURVE_SECP256K1)
+	signatures := []*TxSignature{{
+		Address:   address,
+		PublicKey: hex.EncodeToString(pub),
+		Signature: hex.EncodeToString(signature),
+	}}
+
+	signedHex, err := AssembleSignedTransaction(pkg.RawHex, signatures)
+	if err != nil {
+		t.Fatalf("AssembleSignedTransaction failed, unexpected error: %v", err)
+	}
+	signedBytes, _ := hex.DecodeString(signedHex)
+	rawTx, err := DecodeRawTransaction(signedBytes)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction failed, unexpected error: %v", err)
+	}
+	if len(rawTx.Signatures) != 1 || !bytes.Equal(rawTx.Signatures[0].Signature, signature) {
+		t.Errorf("unexpected signatures: %+v", rawTx.Signatures)
+	}
+	if signedHash, _ := CalcTxHash(signedHex); signedHash != txId {
+		t.Errorf("signed tx hash %s not equal to %s", signedHash, txId)
+	}
+
+	//重复装配替换已有的签名
+	again, err := AssembleSignedTransaction(signedHex, signatures)
+	if err != nil || again != signedHex {
+		t.Errorf("assemble signed transaction again failed, err: %v", err)
+	}
+
+	//其他私钥的有效签名无法装配
+	otherKey := bytes.Repeat([]byte{0x08}, 32)
+	otherPub, _ := owcrypt.GenPubkey(otherKey, owcrypt.ECC_CURVE_SECP256K1)
+	otherPub = owcrypt.PointCompress(otherPub, owcrypt.ECC_CURVE_SECP256K1)
+	otherSignature, _, _ := owcrypt.Signature(otherKey, nil, hash, owcrypt.ECC_CURVE_SECP256K1)
+	others := []*TxSignature{{
+		Address:   address,
+		PublicKey: hex.EncodeToString(otherPub),
+		Signature: hex.EncodeToString(otherSignature),
+	}}
+	if _, err := AssembleSignedTransaction(pkg.RawHex, others); err == nil {
+		t.Errorf("assemble with key of other address should fail")
+	}
+
+	//错误的签名无法装配
+	signatures[0].Signature = hex.EncodeToString(bytes.Repeat([]byte{0x11}, 64))
+	if _, err := AssembleSignedTransaction(pkg.RawHex, signatures); err == nil {
+		t.Errorf("assemble with invalid signature should fail")
+	}
+}
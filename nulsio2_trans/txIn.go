@@ -1,6 +1,9 @@
 package nulsio2_trans
 
-import "encoding/hex"
+import (
+	"encoding/hex"
+	"fmt"
+)
 
 type TxIn struct {
 	Address       []byte
@@ -15,19 +18,54 @@ func newTxInForEmptyTrans(vin []Vin) ([]TxIn, error) {
 	var ret []TxIn
 
 	for _, v := range vin {
+		if v.AssetsChainId == 0 || v.AssetsChainId > 0xFFFF || v.AssetsId == 0 || v.AssetsId > 0xFFFF {
+			return nil, fmt.Errorf("invalid asset %d-%d of input", v.AssetsChainId, v.AssetsId)
+		}
 
 		address, _ := GetBytesWithLength(AddressBase58Decode(v.Address))
-		assetChainId := uint16ToLittleEndianBytes(1)
-		assetsId := uint16ToLittleEndianBytes(1)
+		assetsChainId := uint16ToLittleEndianBytes(uint16(v.AssetsChainId))
+		assetsId := uint16ToLittleEndianBytes(uint16(v.AssetsId))
 
-		na := WriteBigInteger(int64(v.Amount))
+		na, err := WriteBigInteger(v.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount of input: %v", err)
+		}
 
 		nonceByte, _ := hex.DecodeString(v.Nonce)
 		nonce, _ := GetBytesWithLength(nonceByte)
 
 		lockTime := []byte{0}
 
-		ret = append(ret, TxIn{address, assetsId, assetChainId, na, nonce, lockTime})
+		ret = append(ret, TxIn{
+			Address:       address,
+			AssetsChainId: assetsChainId,
+			AssetsId:      assetsId,
+			Amount:        na,
+			Nonce:         nonce,
+			Locked:        lockTime,
+		})
 	}
 	return ret, nil
 }
+
+//ToVin 解析为可读的输入结构
+func (in TxIn) ToVin() Vin {
+	address, _, _ := readBytesWithLength(in.Address)
+	nonce, _, _ := readBytesWithLength(in.Nonce)
+
+	vin := Vin{
+		Address: AddressBase58Encode(address),
+		Amount:  ReadBigInteger(in.Amount),
+		Nonce:   hex.EncodeToString(nonce),
+	}
+	if len(in.AssetsChainId) == 2 {
+		vin.AssetsChainId = uint64(littleEndianBytesToUint16(in.AssetsChainId))
+	}
+	if len(in.AssetsId) == 2 {
+		vin.AssetsId = uint64(littleEndianBytesToUint16(in.AssetsId))
+	}
+	if len(in.Locked) > 0 {
+		vin.LockTime = uint64(in.Locked[0])
+	}
+	return vin
+}
@@ -1,5 +1,7 @@
 package nulsio2_trans
 
+import "fmt"
+
 type TxOut struct {
 	Address       []byte
 	AssetsChainId []byte
@@ -12,18 +14,52 @@ func newTxOutForEmptyTrans(vout []Vout) ([]TxOut, error) {
 	var ret []TxOut
 
 	for _, v := range vout {
+		if v.AssetsChainId == 0 || v.AssetsChainId > 0xFFFF || v.AssetsId == 0 || v.AssetsId > 0xFFFF {
+			return nil, fmt.Errorf("invalid asset %d-%d of output", v.AssetsChainId, v.AssetsId)
+		}
+
 		address, _ := GetBytesWithLength(AddressBase58Decode(v.Address))
-		assetChainId := uint16ToLittleEndianBytes(1)
-		assetsId := uint16ToLittleEndianBytes(1)
+		assetsChainId := uint16ToLittleEndianBytes(uint16(v.AssetsChainId))
+		assetsId := uint16ToLittleEndianBytes(uint16(v.AssetsId))
 
-		na := WriteBigInteger(int64(v.Amount))
+		na, err := WriteBigInteger(v.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount of output: %v", err)
+		}
 
 		//nonceByte, _ := hex.DecodeString(v.Nonce)
 		//nonce, _ := GetBytesWithLength(nonceByte)
 
-		lockTime := []byte{0,0,0,0,0,0,0,0,0}
+		//解锁高度或时间，-1 (0xFFFFFFFFFFFFFFFF) 表示永久锁定
+		lockTime := uint64ToLittleEndianBytes(v.LockTime)
 
-		ret = append(ret, TxOut{address, assetsId, assetChainId, na, lockTime})
+		ret = append(ret, TxOut{
+			Address:       address,
+			AssetsChainId: assetsChainId,
+			AssetsId:      assetsId,
+			Amount:        na,
+			Locked:        lockTime,
+		})
 	}
 	return ret, nil
 }
+
+//ToVout 解析为可读的输出结构
+func (out TxOut) ToVout() Vout {
+	address, _, _ := readBytesWithLength(out.Address)
+
+	vout := Vout{
+		Address: AddressBase58Encode(address),
+		Amount:  ReadBigInteger(out.Amount),
+	}
+	if len(out.AssetsChainId) == 2 {
+		vout.AssetsChainId = uint64(littleEndianBytesToUint16(out.AssetsChainId))
+	}
+	if len(out.AssetsId) == 2 {
+		vout.AssetsId = uint64(littleEndianBytesToUint16(out.AssetsId))
+	}
+	if len(out.Locked) >= 8 {
+		vout.LockTime = littleEndianBytesToUint64(out.Locked[:8])
+	}
+	return vout
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"github.com/blocktree/go-owcrypt"
-	"time"
 )
 
 const (
@@ -24,6 +23,7 @@ type Transaction struct {
 	Witness  []TxWitness
 	LockTime []byte
 	//	HashType []byte
+	Signatures []SigPub
 }
 
 func newTransaction(vins []Vin, vouts []Vout, remark []byte, lockTime uint32, txToken *TxToken, replaceable bool) (*Transaction, error) {
@@ -45,15 +45,27 @@ func newTransaction(vins []Vin, vouts []Vout, remark []byte, lockTime uint32, tx
 		return nil, err
 	}
 
+	txType := TxTypeTransfer
 	var txTokenBytes []byte
 	if txToken != nil {
 		txTokenBytes, err = newTxTokenToBytes(txToken)
 		if err != nil {
 			return nil, err
 		}
+		txType = TxTypeCallContract
 	}
 
-	return &Transaction{0, 0, version, remarkBytes, txTokenBytes, txIn, txOut, nil, locktime}, nil
+	//交易时间只在创建时确定，之后的编码保持不变
+	return &Transaction{
+		Type:     txType,
+		Time:     TxClock().Unix(),
+		Version:  version,
+		Remark:   remarkBytes,
+		TxData:   txTokenBytes,
+		Vins:     txIn,
+		Vouts:    txOut,
+		LockTime: locktime,
+	}, nil
 }
 
 func (t Transaction) encodeToBytes() ([]byte, error) {
@@ -64,22 +76,21 @@ func (t Transaction) encodeToBytes() ([]byte, error) {
 
 
 	ret := []byte{}
-	var txType []byte
-	if t.TxData == nil {
-		txType = uint16ToLittleEndianBytes(2)
-		if len(t.Vouts) == 0 {
-			return nil, errors.New("No output found in the transaction struct!")
+	txType := t.Type
+	if txType == 0 {
+		if t.TxData == nil {
+			txType = TxTypeTransfer
+		} else {
+			txType = TxTypeCallContract
 		}
-	}else{
-		txType = uint16ToLittleEndianBytes(16)
+	}
+	if txType == TxTypeTransfer && len(t.Vouts) == 0 {
+		return nil, errors.New("No output found in the transaction struct!")
 	}
 
-
-	ret = append(ret, txType...)
-	now := time.Now().Unix()
-	//now = now + 156779961  //新版本的offset
-	nowByte := uint32ToLittleEndianBytes(uint32(now))
-	ret = append(ret, nowByte...)
+	ret = append(ret, uint16ToLittleEndianBytes(uint16(txType))...)
+	timeByte := uint32ToLittleEndianBytes(uint32(t.Time))
+	ret = append(ret, timeByte...)
 	if t.Remark == nil {
 		ret = append(ret, 0) //remark
 	} else {
@@ -147,150 +158,245 @@ func (t Transaction) encodeToBytes() ([]byte, error) {
 	return ret, nil
 }
 
-//
-//func DecodeRawTransaction(txBytes []byte) (*Transaction, error) {
-//	limit := len(txBytes)
-//	if limit == 0 {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	var rawTx Transaction
-//	index := int(0)
-//	segwit := false
-//
-//	if index+8 > limit {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	index += 8
-//
-//	if index+1 > limit {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	index += 1
-//	if txBytes[index] != 0 {
-//		return nil, errors.New("not support remarks")
-//	}
-//	if index+4 > limit {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	index += 4
-//	inputCountByte := txBytes[index]
-//
-//	if index+1 > limit {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	numOfVins := txBytes[index]
-//	index++
-//
-//	for i := byte(0); i < numOfVins; i++ {
-//		var tmpTxIn TxIn
-//
-//		if index+32 > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		tmpTxIn.TxID = txBytes[index : index+32]
-//		index += 32
-//
-//		if index+4 > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		tmpTxIn.Vout = txBytes[index : index+4]
-//		index += 4
-//
-//		if index+1 > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		scriptLen := txBytes[index]
-//		index++
-//		if scriptLen == 0 {
-//			tmpTxIn.ScriptPubkeySignature = nil
-//		} else {
-//			if index+int(scriptLen) > limit {
-//				return nil, errors.New("Invalid transaction data length!")
-//			}
-//			tmpTxIn.ScriptPubkeySignature = txBytes[index : index+int(scriptLen)]
-//		}
-//		index += int(scriptLen)
-//
-//		if index+4 > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		tmpTxIn.Sequence = txBytes[index : index+4]
-//		index += 4
-//
-//		rawTx.Vins = append(rawTx.Vins, tmpTxIn)
-//	}
-//
-//	if index+1 > limit {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	numOfVouts := txBytes[index]
-//	index++
-//
-//	for i := byte(0); i < numOfVouts; i++ {
-//		var tmpTxOut TxOut
-//
-//		if index+8 > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		tmpTxOut.amount = txBytes[index : index+8]
-//		index += 8
-//
-//		if index+1 > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		lockScriptLen := txBytes[index]
-//		index++
-//
-//		if index+int(lockScriptLen) > limit {
-//			return nil, errors.New("Invalid transaction data length!")
-//		}
-//		tmpTxOut.lockScript = txBytes[index : index+int(lockScriptLen)]
-//		index += int(lockScriptLen)
-//
-//		rawTx.Vouts = append(rawTx.Vouts, tmpTxOut)
-//	}
-//
-//	if segwit {
-//		for i := byte(0); i < numOfVins; i++ {
-//			if index+1 > limit {
-//				return nil, errors.New("Invalid transaction data length!")
-//			}
-//			if txBytes[index] == 0x00 {
-//				rawTx.Witness = append(rawTx.Witness, TxWitness{})
-//				index++
-//			} else if txBytes[index] == 0x02 {
-//				index++
-//
-//				if index+1 > limit {
-//					return nil, errors.New("Invalid transaction data length!")
-//				}
-//				length := txBytes[index]
-//
-//				if index+int(length)+1+34 > limit {
-//					return nil, errors.New("Invalid transaction data length!")
-//				}
-//				witness, _ := decodeFromSegwitBytes(txBytes[index : index+int(length)+1+34])
-//				rawTx.Witness = append(rawTx.Witness, *witness)
-//
-//				index += int(length) + 1 + 34
-//			} else {
-//				//TODO
-//				//for multisig
-//			}
-//		}
-//	}
-//
-//	if index+4 > limit {
-//		return nil, errors.New("Invalid transaction data length!")
-//	}
-//	rawTx.LockTime = txBytes[index : index+4]
-//	index += 4
-//
-//	if index != limit {
-//		return nil, errors.New("Too much transaction data!")
-//	}
-//	return &rawTx, nil
-//}
+//DecodeRawTransaction 解析NULS2.0原始交易单，支持未签名及已签名的交易单
+func DecodeRawTransaction(txBytes []byte) (*Transaction, error) {
+	rawTx, _, err := decodeRawTransaction(txBytes)
+	if err != nil {
+		return nil, err
+	}
+	return rawTx, nil
+}
+
+//decodeRawTransaction 解析原始交易单，同时返回交易主体（不含签名部分）的结束位置
+func decodeRawTransaction(txBytes []byte) (*Transaction, int, error) {
+	limit := len(txBytes)
+	if limit == 0 {
+		return nil, 0, errors.New("Invalid transaction data length!")
+	}
+	var rawTx Transaction
+	index := 0
+
+	if index+2 > limit {
+		return nil, 0, errors.New("Invalid transaction data length!")
+	}
+	rawTx.Type = int64(littleEndianBytesToUint16(txBytes[index : index+2]))
+	index += 2
+
+	if index+4 > limit {
+		return nil, 0, errors.New("Invalid transaction data length!")
+	}
+	rawTx.Time = int64(littleEndianBytesToUint32(txBytes[index : index+4]))
+	index += 4
+
+	//remark保留长度前缀，与encodeToBytes保持一致
+	remark, index, err := nextBytesWithLength(txBytes, index)
+	if err != nil {
+		return nil, 0, err
+	}
+	rawTx.Remark = remark
+
+	txData, index, err := nextBytesWithLength(txBytes, index)
+	if err != nil {
+		return nil, 0, err
+	}
+	txDataBytes, _, _ := readBytesWithLength(txData)
+	if len(txDataBytes) > 0 {
+		rawTx.TxData = txDataBytes
+	}
+
+	coinData, index, err := nextBytesWithLength(txBytes, index)
+	if err != nil {
+		return nil, 0, err
+	}
+	coinDataBytes, _, _ := readBytesWithLength(coinData)
+	rawTx.Vins, rawTx.Vouts, err = decodeCoinData(coinDataBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bodyEnd := index
+
+	//签名部分，未签名的交易单没有该部分
+	if index < limit {
+		sigData, nextIndex, err := nextBytesWithLength(txBytes, index)
+		if err != nil {
+			return nil, 0, err
+		}
+		index = nextIndex
+		sigDataBytes, _, _ := readBytesWithLength(sigData)
+		rawTx.Signatures, err = decodeSignatures(sigDataBytes)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if index != limit {
+		return nil, 0, errors.New("Too much transaction data!")
+	}
+	return &rawTx, bodyEnd, nil
+}
+
+//decodeCoinData 解析coinData中的from和to列表
+func decodeCoinData(coinData []byte) ([]TxIn, []TxOut, error) {
+	var (
+		vins  []TxIn
+		vouts []TxOut
+	)
+	limit := len(coinData)
+	index := 0
+
+	numOfVins, size, err := VarIntDecode(coinData[index:])
+	if err != nil {
+		return nil, nil, err
+	}
+	index += size
+
+	for i := int64(0); i < numOfVins; i++ {
+		var tmpTxIn TxIn
+
+		tmpTxIn.Address, index, err = nextBytesWithLength(coinData, index)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if index+2+2+32 > limit {
+			return nil, nil, errors.New("Invalid coin data length!")
+		}
+		tmpTxIn.AssetsChainId = coinData[index : index+2]
+		index += 2
+		tmpTxIn.AssetsId = coinData[index : index+2]
+		index += 2
+		tmpTxIn.Amount = coinData[index : index+32]
+		index += 32
+
+		tmpTxIn.Nonce, index, err = nextBytesWithLength(coinData, index)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if index+1 > limit {
+			return nil, nil, errors.New("Invalid coin data length!")
+		}
+		tmpTxIn.Locked = coinData[index : index+1]
+		index += 1
+
+		vins = append(vins, tmpTxIn)
+	}
+
+	if index+1 > limit {
+		return nil, nil, errors.New("Invalid coin data length!")
+	}
+	numOfVouts, size, err := VarIntDecode(coinData[index:])
+	if err != nil {
+		return nil, nil, err
+	}
+	index += size
+
+	for i := int64(0); i < numOfVouts; i++ {
+		var tmpTxOut TxOut
+
+		tmpTxOut.Address, index, err = nextBytesWithLength(coinData, index)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if index+2+2+32+8 > limit {
+			return nil, nil, errors.New("Invalid coin data length!")
+		}
+		tmpTxOut.AssetsChainId = coinData[index : index+2]
+		index += 2
+		tmpTxOut.AssetsId = coinData[index : index+2]
+		index += 2
+		tmpTxOut.Amount = coinData[index : index+32]
+		index += 32
+		tmpTxOut.Locked = coinData[index : index+8]
+		index += 8
+
+		vouts = append(vouts, tmpTxOut)
+	}
+
+	//与节点一致，coinData末尾多余的数据不参与解析
+	return vins, vouts, nil
+}
+
+//decodeSignatures 解析交易签名部分，每个签名由公钥和DER编码的签名组成
+func decodeSignatures(sigData []byte) ([]SigPub, error) {
+	var (
+		sigPubs []SigPub
+		index   = 0
+		err     error
+	)
+
+	for index < len(sigData) {
+		var pub, der []byte
+
+		pub, index, err = nextBytesWithLength(sigData, index)
+		if err != nil {
+			return nil, err
+		}
+
+		der, index, err = nextBytesWithLength(sigData, index)
+		if err != nil {
+			return nil, err
+		}
+
+		pubBytes, _, _ := readBytesWithLength(pub)
+		derBytes, _, _ := readBytesWithLength(der)
+		signature, err := decodeDERSignature(derBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		sigPubs = append(sigPubs, SigPub{PublicKey: pubBytes, Signature: signature})
+	}
+	return sigPubs, nil
+}
+
+//decodeDERSignature DER编码的签名转为64字节的r+s
+func decodeDERSignature(der []byte) ([]byte, error) {
+	if len(der) < 8 || der[0] != 0x30 || int(der[1]) != len(der)-2 {
+		return nil, errors.New("Invalid signature data!")
+	}
+	index := 2
+
+	r, index, err := nextDERInteger(der, index)
+	if err != nil {
+		return nil, err
+	}
+	s, index, err := nextDERInteger(der, index)
+	if err != nil {
+		return nil, err
+	}
+	if index != len(der) {
+		return nil, errors.New("Invalid signature data!")
+	}
+
+	signature := make([]byte, 64)
+	copy(signature[32-len(r):32], r)
+	copy(signature[64-len(s):], s)
+	return signature, nil
+}
+
+func nextDERInteger(der []byte, index int) ([]byte, int, error) {
+	if index+2 > len(der) || der[index] != 0x02 {
+		return nil, 0, errors.New("Invalid signature data!")
+	}
+	length := int(der[index+1])
+	index += 2
+	if index+length > len(der) {
+		return nil, 0, errors.New("Invalid signature data!")
+	}
+	value := der[index : index+length]
+	index += length
+
+	for len(value) > 0 && value[0] == 0 {
+		value = value[1:]
+	}
+	if len(value) > 32 {
+		return nil, 0, errors.New("Invalid signature data!")
+	}
+	return value, index, nil
+}
 
 func isScriptHash(script []byte) bool {
 	if script[0] == OpCodeDup && script[1] == OpCodeHash160 && script[2] == 0x14 && script[23] == OpCodeEqualVerify && script[24] == OpCodeCheckSig {
@@ -447,3 +553,27 @@ func (t Transaction) getHashesForSig(unlockData []TxUnlock) ([][]byte, error) {
 	return hashes, nil
 }
 
+
+//GetRemark 交易备注
+func (t Transaction) GetRemark() string {
+	remark, _, _ := readBytesWithLength(t.Remark)
+	return string(remark)
+}
+
+//GetVins 交易输入列表
+func (t Transaction) GetVins() []Vin {
+	vins := make([]Vin, 0, len(t.Vins))
+	for _, in := range t.Vins {
+		vins = append(vins, in.ToVin())
+	}
+	return vins
+}
+
+//GetVouts 交易输出列表
+func (t Transaction) GetVouts() []Vout {
+	vouts := make([]Vout, 0, len(t.Vouts))
+	for _, out := range t.Vouts {
+		vouts = append(vouts, out.ToVout())
+	}
+	return vouts
+}
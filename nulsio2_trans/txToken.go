@@ -1,14 +1,34 @@
 package nulsio2_trans
 
+import (
+	"fmt"
+	"math/big"
+)
+
 type TxToken struct {
 	Sender          string
 	ContractAddress string
-	Value           uint64
+	Value           *big.Int
 	GasLimit        uint64
 	Price           uint64
 	MethodName      string
+	MethodDesc      string
 	ArgsCount       int64
 	Args            []string
+	//多维参数，每个参数为字符串数组，设置后替代Args
+	MultiArgs [][]string
+}
+
+//GetArgs 获取合约调用参数，每个参数编码为字符串数组
+func (tx *TxToken) GetArgs() [][]string {
+	if tx.MultiArgs != nil {
+		return tx.MultiArgs
+	}
+	args := make([][]string, 0, len(tx.Args))
+	for _, v := range tx.Args {
+		args = append(args, []string{v})
+	}
+	return args
 }
 
 func newTxTokenToBytes(tx *TxToken) ([]byte, error) {
@@ -18,7 +38,10 @@ func newTxTokenToBytes(tx *TxToken) ([]byte, error) {
 	//contractAddress := nulsio2_addrdec.Base58Decode([]byte(tx.ContractAddress))
 	contractAddress := AddressBase58Decode(tx.ContractAddress)
 	ret = append(ret, contractAddress...)
-	valueBytes := WriteBigInteger(int64(tx.Value))
+	valueBytes, err := WriteBigInteger(tx.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of contract call: %v", err)
+	}
 	ret = append(ret, valueBytes...)
 	gasLimitBytes := int64ToLittleEndianBytes(tx.GasLimit)
 	ret = append(ret, gasLimitBytes...)
@@ -26,12 +49,96 @@ func newTxTokenToBytes(tx *TxToken) ([]byte, error) {
 	ret = append(ret, price...)
 	methodName, _ := GetBytesWithLength([]byte(tx.MethodName))
 	ret = append(ret, methodName...)
-	ret = append(ret, 0)
-	ret = append(ret, byte(tx.ArgsCount))
-	for _, v := range tx.Args {
-		arg, _ := GetBytesWithLength([]byte(v))
-		ret = append(ret, 1)
-		ret = append(ret, arg...)
+	methodDesc, _ := GetBytesWithLength([]byte(tx.MethodDesc))
+	ret = append(ret, methodDesc...)
+
+	args := tx.GetArgs()
+	argsCount := tx.ArgsCount
+	if tx.MultiArgs != nil || argsCount == 0 {
+		argsCount = int64(len(args))
+	}
+	if argsCount != int64(len(args)) || argsCount > 0xFF {
+		return nil, fmt.Errorf("invalid args count: %d", argsCount)
+	}
+	ret = append(ret, byte(argsCount))
+	for _, v := range args {
+		if len(v) > 0xFF {
+			return nil, fmt.Errorf("too many elements of arg: %d", len(v))
+		}
+		ret = append(ret, byte(len(v)))
+		for _, e := range v {
+			arg, _ := GetBytesWithLength([]byte(e))
+			ret = append(ret, arg...)
+		}
 	}
 	return ret, nil
 }
+
+//Size 合约调用数据的字节数
+func (tx *TxToken) Size() int {
+	txTokenBytes, err := newTxTokenToBytes(tx)
+	if err != nil {
+		return 0
+	}
+	return len(txTokenBytes)
+}
+
+//DecodeTxToken 解析合约调用数据
+func DecodeTxToken(data []byte) (*TxToken, error) {
+	const fixedSize = 23 + 23 + 32 + 8 + 8
+	if len(data) < fixedSize {
+		return nil, fmt.Errorf("invalid contract call data length: %d", len(data))
+	}
+
+	tx := &TxToken{
+		Sender:          AddressBase58Encode(data[:23]),
+		ContractAddress: AddressBase58Encode(data[23:46]),
+		Value:           ReadBigInteger(data[46:78]),
+		GasLimit:        littleEndianBytesToUint64(data[78:86]),
+		Price:           littleEndianBytesToUint64(data[86:94]),
+	}
+	index := fixedSize
+
+	methodName, size, err := readBytesWithLength(data[index:])
+	if err != nil {
+		return nil, err
+	}
+	tx.MethodName = string(methodName)
+	index += size
+
+	methodDesc, size, err := readBytesWithLength(data[index:])
+	if err != nil {
+		return nil, err
+	}
+	tx.MethodDesc = string(methodDesc)
+	index += size
+
+	if index >= len(data) {
+		return nil, fmt.Errorf("contract call data is missing args count")
+	}
+	argsCount := int(data[index])
+	index++
+
+	tx.ArgsCount = int64(argsCount)
+	tx.MultiArgs = make([][]string, 0, argsCount)
+	for i := 0; i < argsCount; i++ {
+		if index >= len(data) {
+			return nil, fmt.Errorf("contract call data is missing arg %d", i)
+		}
+		count := int(data[index])
+		index++
+
+		arg := make([]string, 0, count)
+		for j := 0; j < count; j++ {
+			e, size, err := readBytesWithLength(data[index:])
+			if err != nil {
+				return nil, err
+			}
+			arg = append(arg, string(e))
+			index += size
+		}
+		tx.MultiArgs = append(tx.MultiArgs, arg)
+	}
+
+	return tx, nil
+}
@@ -45,6 +45,11 @@ func littleEndianBytesToUint32(data []byte) uint32 {
 	return binary.LittleEndian.Uint32(data)
 }
 
+//littleEndianBytesToUint16
+func littleEndianBytesToUint16(data []byte) uint16 {
+	return binary.LittleEndian.Uint16(data)
+}
+
 //uint48ToLittleEndianBytes
 func uint48ToLittleEndianBytes(data uint64) []byte {
 	tmp := [6]byte{}
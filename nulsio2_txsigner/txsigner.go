@@ -1,9 +1,13 @@
 package nulsio2_txsigner
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/nulsio2-adapter/nulsio2_trans"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
 )
 
 
@@ -12,37 +16,75 @@ var Default = &TransactionSigner{}
 type TransactionSigner struct {
 }
 
-// SignTransactionHash 交易哈希签名算法
+// SignTransactionHash 交易哈希签名算法，msg为交易单哈希，返回64字节的r+s
 // required
 func (singer *TransactionSigner) SignTransactionHash(msg []byte, prikey []byte, eccType uint32) ([]byte, error) {
-	msg = nulsio2_trans.Sha256Twice(msg) //sha256
-
-	signature, retCode := owcrypt.Signature(prikey, nil, 0, msg, 32, owcrypt.ECC_CURVE_SECP256K1)
+	signature, _, retCode := owcrypt.Signature(prikey, nil, msg, owcrypt.ECC_CURVE_SECP256K1)
 	if retCode != owcrypt.SUCCESS {
 		return nil, errors.New("Failed to sign message!")
 	}
 
-	pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
-	if ret != owcrypt.SUCCESS {
-		return nil, errors.New("Get Pubkey failed!")
-	}
-	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+	return signature, nil
+}
 
-	sigPub := &nulsio2_trans.SigPub{
-		pub,
-		signature,
+//SignUnsignedTxPackage 离线签名，getKey返回输入地址的私钥，签名前校验签名包与原始交易单一致，不需要访问节点
+func (singer *TransactionSigner) SignUnsignedTxPackage(pkg *nulsio2_trans.UnsignedTxPackage, getKey func(input *nulsio2_trans.UnsignedTxInput) ([]byte, error)) ([]*nulsio2_trans.TxSignature, error) {
+	if err := pkg.Check(); err != nil {
+		return nil, err
 	}
 
+	signatures := make([]*nulsio2_trans.TxSignature, 0)
+	for _, input := range pkg.Signers() {
+		prikey, err := getKey(input)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+		if ret != owcrypt.SUCCESS {
+			return nil, errors.New("Get Pubkey failed!")
+		}
+		pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+		publicKey := hex.EncodeToString(pub)
 
-	result := make([]byte, 0)
-	result = append(result, byte(len(pub)))
-	result = append(result, pub...)
+		//私钥必须与签名包中的公钥和输入地址一致
+		if len(input.PublicKey) > 0 && input.PublicKey != publicKey {
+			return nil, fmt.Errorf("private key not match public key of address: %s", input.Address)
+		}
+		if err := nulsio2_trans.CheckAddressPublicKey(input.Address, pub); err != nil {
+			return nil, err
+		}
 
-	result = append(result, 0)
-	resultSig := make([]byte, 0)
-	resultSig = append(resultSig, sigPub.ToBytes()...)
+		hash, err := hex.DecodeString(input.SigningHash)
+		if err != nil {
+			return nil, err
+		}
 
-	result = append(result, resultSig...)
+		signature, err := singer.SignTransactionHash(hash, prikey, owcrypt.ECC_CURVE_SECP256K1)
+		if err != nil {
+			return nil, err
+		}
+
+		signatures = append(signatures, &nulsio2_trans.TxSignature{
+			Address:   input.Address,
+			PublicKey: publicKey,
+			Signature: hex.EncodeToString(signature),
+		})
+	}
+
+	return signatures, nil
+}
 
-	return result, nil
+//SignUnsignedTxPackageWithHDKey 使用HD密钥按输入的派生路径离线签名
+func (singer *TransactionSigner) SignUnsignedTxPackageWithHDKey(pkg *nulsio2_trans.UnsignedTxPackage, key *hdkeystore.HDKey) ([]*nulsio2_trans.TxSignature, error) {
+	return singer.SignUnsignedTxPackage(pkg, func(input *nulsio2_trans.UnsignedTxInput) ([]byte, error) {
+		if len(input.DerivedPath) == 0 {
+			return nil, fmt.Errorf("derived path of address: %s is empty", input.Address)
+		}
+		childKey, err := key.DerivedKeyWithPath(input.DerivedPath, owcrypt.ECC_CURVE_SECP256K1)
+		if err != nil {
+			return nil, err
+		}
+		return childKey.GetPrivateKeyBytes()
+	})
 }